@@ -0,0 +1,255 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Find the articulation stations: stations whose removal splits their part of the network in two
+func articulationPoints(network *Network) []string {
+	_, points := tarjan(network)
+	return points
+}
+
+// Find the bridge connections: connections whose removal splits their part of the network in two
+func bridges(network *Network) [][2]string {
+	found, _ := tarjan(network)
+	return found
+}
+
+// Depth-first search keeping discovery times and low links, finds bridges and articulation stations at once
+func tarjan(network *Network) ([][2]string, []string) {
+	discovery := make(map[string]int)
+	low := make(map[string]int)
+	isArticulation := make(map[string]bool)
+	var foundBridges [][2]string
+	time := 0
+
+	var dfs func(station, parent string)
+	dfs = func(station, parent string) {
+		time++
+		discovery[station] = time
+		low[station] = time
+		children := 0
+		for _, neighbor := range network.Connections[station] {
+			if neighbor == parent {
+				continue
+			}
+			if discovery[neighbor] != 0 {
+				if discovery[neighbor] < low[station] {
+					low[station] = discovery[neighbor]
+				}
+				continue
+			}
+			children++
+			dfs(neighbor, station)
+			if low[neighbor] < low[station] {
+				low[station] = low[neighbor]
+			}
+			if low[neighbor] > discovery[station] {
+				foundBridges = append(foundBridges, [2]string{station, neighbor})
+			}
+			if parent != "" && low[neighbor] >= discovery[station] {
+				isArticulation[station] = true
+			}
+		}
+		if parent == "" && children > 1 {
+			isArticulation[station] = true
+		}
+	}
+
+	for _, name := range sortedStationNames(network) {
+		if discovery[name] == 0 {
+			dfs(name, "")
+		}
+	}
+
+	var points []string
+	for name := range isArticulation {
+		points = append(points, name)
+	}
+	sort.Strings(points)
+	return foundBridges, points
+}
+
+// Flow network with integer capacities, edges are stored in pairs so edge^1 is the reverse edge
+type flowGraph struct {
+	to        []int
+	capacity  []int
+	adjacency [][]int
+}
+
+func newFlowGraph(size int) *flowGraph {
+	return &flowGraph{adjacency: make([][]int, size)}
+}
+
+func (g *flowGraph) addEdge(from, to, capacity int) {
+	g.adjacency[from] = append(g.adjacency[from], len(g.to))
+	g.to = append(g.to, to)
+	g.capacity = append(g.capacity, capacity)
+	g.adjacency[to] = append(g.adjacency[to], len(g.to))
+	g.to = append(g.to, from)
+	g.capacity = append(g.capacity, 0)
+}
+
+// Push flow along shortest augmenting paths until none is left, returns the flow and
+// the nodes still reachable from the source in the residual graph
+func (g *flowGraph) maxFlow(source, sink int) (int, []bool) {
+	flow := 0
+	for {
+		parentEdge := make([]int, len(g.adjacency))
+		for i := range parentEdge {
+			parentEdge[i] = -1
+		}
+		reached := make([]bool, len(g.adjacency))
+		reached[source] = true
+		queue := []int{source}
+		for len(queue) > 0 && !reached[sink] {
+			node := queue[0]
+			queue = queue[1:]
+			for _, edge := range g.adjacency[node] {
+				next := g.to[edge]
+				if !reached[next] && g.capacity[edge] > 0 {
+					reached[next] = true
+					parentEdge[next] = edge
+					queue = append(queue, next)
+				}
+			}
+		}
+		if !reached[sink] {
+			return flow, reached
+		}
+
+		// Find the bottleneck of the path and push it
+		bottleneck := -1
+		for node := sink; node != source; node = g.to[parentEdge[node]^1] {
+			if bottleneck == -1 || g.capacity[parentEdge[node]] < bottleneck {
+				bottleneck = g.capacity[parentEdge[node]]
+			}
+		}
+		for node := sink; node != source; node = g.to[parentEdge[node]^1] {
+			g.capacity[parentEdge[node]] -= bottleneck
+			g.capacity[parentEdge[node]^1] += bottleneck
+		}
+		flow += bottleneck
+	}
+}
+
+// Find the smallest set of connections whose removal disconnects the start station from the end station
+func minimumConnectionCut(network *Network, startStation, endStation string) [][2]string {
+	names := sortedStationNames(network)
+	index := make(map[string]int)
+	for i, name := range names {
+		index[name] = i
+	}
+
+	graph := newFlowGraph(len(names))
+	for _, name := range names {
+		for _, neighbor := range network.Connections[name] {
+			graph.addEdge(index[name], index[neighbor], 1)
+		}
+	}
+	_, reached := graph.maxFlow(index[startStation], index[endStation])
+
+	var cut [][2]string
+	for _, name := range names {
+		for _, neighbor := range network.Connections[name] {
+			if reached[index[name]] && !reached[index[neighbor]] {
+				cut = append(cut, [2]string{name, neighbor})
+			}
+		}
+	}
+	return cut
+}
+
+// Find the smallest set of stations whose removal disconnects the start station from the end station
+// Returns false when the two stations are directly connected, as no station cut exists then
+func minimumStationCut(network *Network, startStation, endStation string) ([]string, bool) {
+	if contains(network.Connections[startStation], endStation) {
+		return nil, false
+	}
+
+	// Every station is split into an entry node (2i) and an exit node (2i+1) joined by a unit capacity edge
+	names := sortedStationNames(network)
+	index := make(map[string]int)
+	for i, name := range names {
+		index[name] = i
+	}
+	unlimited := len(names) + 1
+
+	graph := newFlowGraph(2 * len(names))
+	for i, name := range names {
+		capacity := 1
+		if name == startStation || name == endStation {
+			capacity = unlimited
+		}
+		graph.addEdge(2*i, 2*i+1, capacity)
+		for _, neighbor := range network.Connections[name] {
+			graph.addEdge(2*i+1, 2*index[neighbor], unlimited)
+		}
+	}
+	_, reached := graph.maxFlow(2*index[startStation]+1, 2*index[endStation])
+
+	var cut []string
+	for i, name := range names {
+		if reached[2*i] && !reached[2*i+1] {
+			cut = append(cut, name)
+		}
+	}
+	return cut, true
+}
+
+// Join connections as "a-b" for printing
+func formatConnections(connections [][2]string) string {
+	parts := make([]string, len(connections))
+	for i, connection := range connections {
+		parts[i] = connection[0] + "-" + connection[1]
+	}
+	return strings.Join(parts, ", ")
+}
+
+// analyze command: go run . analyze <map> [start end]
+func runAnalyze(args []string) {
+	if len(args) != 1 && len(args) != 3 {
+		handleError("Usage: analyze <map file> [start station end station]")
+	}
+
+	network, err := parseNetworkMap(args[0])
+	if err != nil {
+		handleError(err.Error())
+	}
+
+	points := articulationPoints(network)
+	fmt.Printf("Articulation stations (%d): %s\n", len(points), strings.Join(points, ", "))
+	found := bridges(network)
+	fmt.Printf("Bridge connections (%d): %s\n", len(found), formatConnections(found))
+
+	if len(args) == 1 {
+		return
+	}
+
+	startStation, endStation := args[1], args[2]
+	if _, exists := network.Stations[startStation]; !exists {
+		handleError("Start station does not exist: " + startStation)
+	}
+	if _, exists := network.Stations[endStation]; !exists {
+		handleError("End station does not exist: " + endStation)
+	}
+	if startStation == endStation {
+		handleError("Start station: '" + startStation + "' and end station: '" + endStation + "' are the same")
+	}
+	if !pathExists(startStation, endStation, network, lastClosureTurn(network)+1) {
+		fmt.Printf("No path exists between '%s' and '%s', nothing to cut\n", startStation, endStation)
+		return
+	}
+
+	connectionCut := minimumConnectionCut(network, startStation, endStation)
+	fmt.Printf("Minimum connection cut between %s and %s (%d): %s\n", startStation, endStation, len(connectionCut), formatConnections(connectionCut))
+	stationCut, exists := minimumStationCut(network, startStation, endStation)
+	if !exists {
+		fmt.Printf("Minimum station cut between %s and %s: none, the stations are directly connected\n", startStation, endStation)
+		return
+	}
+	fmt.Printf("Minimum station cut between %s and %s (%d): %s\n", startStation, endStation, len(stationCut), strings.Join(stationCut, ", "))
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Regexes for the key=value attributes after a station or connection, values with spaces are quoted
+// and a quoted value escapes its quotes and backslashes with a backslash
+var (
+	attributesPattern = `((?:\s+[a-zA-Z_][a-zA-Z0-9_.-]*=(?:"(?:[^"\\]|\\.)*"|[^\s#"]+))*)`
+	attributeRegex    = regexp.MustCompile(`([a-zA-Z_][a-zA-Z0-9_.-]*)=(?:"((?:[^"\\]|\\.)*)"|([^\s#"]+))`)
+	escapedRegex      = regexp.MustCompile(`\\(.)`)
+)
+
+// Parse the attributes of a line, keeping their order
+// The known keys are checked: platforms has to be a positive whole number
+func parseAttributes(text string) ([]Attribute, error) {
+	var attributes []Attribute
+	for _, match := range attributeRegex.FindAllStringSubmatch(text, -1) {
+		key, value := match[1], escapedRegex.ReplaceAllString(match[2], "$1")+match[3]
+		if _, exists := attributeValue(attributes, key); exists {
+			return nil, errors.New("duplicate attribute " + key)
+		}
+		if key == "platforms" {
+			if platforms, err := strconv.Atoi(value); err != nil || platforms < 1 {
+				return nil, errors.New("invalid platforms attribute " + value)
+			}
+		}
+		attributes = append(attributes, Attribute{Key: key, Value: value})
+	}
+	return attributes, nil
+}
+
+// Write attributes as they appear in the map format, with a leading space
+func formatAttributes(attributes []Attribute) string {
+	var text strings.Builder
+	for _, attribute := range attributes {
+		value := attribute.Value
+		if value == "" || strings.ContainsAny(value, " \t#\"") {
+			value = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+		}
+		fmt.Fprintf(&text, " %s=%s", attribute.Key, value)
+	}
+	return text.String()
+}
+
+// Look up an attribute by key
+func attributeValue(attributes []Attribute, key string) (string, bool) {
+	for _, attribute := range attributes {
+		if attribute.Key == key {
+			return attribute.Value, true
+		}
+	}
+	return "", false
+}
+
+// Attributes without the given key
+func withoutAttribute(attributes []Attribute, key string) []Attribute {
+	var kept []Attribute
+	for _, attribute := range attributes {
+		if attribute.Key != key {
+			kept = append(kept, attribute)
+		}
+	}
+	return kept
+}
+
+// Turn a map of attributes, as read from GeoJSON properties, into attributes ordered by key
+func sortedAttributes(values map[string]string) []Attribute {
+	var attributes []Attribute
+	for key, value := range values {
+		attributes = append(attributes, Attribute{Key: key, Value: value})
+	}
+	sort.Slice(attributes, func(i, j int) bool {
+		return attributes[i].Key < attributes[j].Key
+	})
+	return attributes
+}
+
+// Key of a connection in Network.ConnectionAttributes, the same in both directions
+// The names are kept apart rather than joined, since quoted names may hold "-" themselves.
+func connectionKey(station1, station2 string) [2]string {
+	if station2 < station1 {
+		station1, station2 = station2, station1
+	}
+	return [2]string{station1, station2}
+}
+
+// Attributes of the connection between two stations
+func connectionAttributes(network *Network, station1, station2 string) []Attribute {
+	return network.ConnectionAttributes[connectionKey(station1, station2)]
+}
+
+// Names of the stations with the given attribute value, in definition order
+func stationsWithAttribute(network *Network, key, value string) []string {
+	var names []string
+	for _, name := range network.StationOrder {
+		if stationValue, exists := attributeValue(network.Stations[name].Attributes, key); exists && stationValue == value {
+			names = append(names, name)
+		}
+	}
+	return names
+}
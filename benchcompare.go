@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// BenchmarkResult struct to store the mean of the runs of one benchmark from "go test -bench" output
+type BenchmarkResult struct {
+	Name        string
+	Runs        int
+	NsPerOp     float64
+	AllocsPerOp float64 // -1 when the output has no allocation counts
+}
+
+// A benchmark line such as "BenchmarkPathExists/grid-8   100   10448768 ns/op   0 B/op   0 allocs/op"
+var benchmarkLineRegex = regexp.MustCompile(`^(Benchmark\S+?)(?:-[0-9]+)?\s+[0-9]+\s+([0-9.]+) ns/op(?:.*?\s([0-9.]+) allocs/op)?`)
+
+// Read benchmark results from "go test -bench" output, averaging benchmarks run more than once with -count
+func parseBenchmarkResults(reader io.Reader) (map[string]*BenchmarkResult, error) {
+	results := make(map[string]*BenchmarkResult)
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		match := benchmarkLineRegex.FindStringSubmatch(scanner.Text())
+		if match == nil {
+			continue
+		}
+		nsPerOp, err := strconv.ParseFloat(match[2], 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid benchmark time: %s", scanner.Text())
+		}
+		allocsPerOp := -1.0
+		if match[3] != "" {
+			if allocsPerOp, err = strconv.ParseFloat(match[3], 64); err != nil {
+				return nil, fmt.Errorf("Invalid benchmark allocations: %s", scanner.Text())
+			}
+		}
+
+		result, exists := results[match[1]]
+		if !exists {
+			result = &BenchmarkResult{Name: match[1], AllocsPerOp: allocsPerOp}
+			results[match[1]] = result
+		}
+		// Running mean over the runs of the benchmark
+		result.Runs++
+		result.NsPerOp += (nsPerOp - result.NsPerOp) / float64(result.Runs)
+		if allocsPerOp >= 0 && result.AllocsPerOp >= 0 {
+			result.AllocsPerOp += (allocsPerOp - result.AllocsPerOp) / float64(result.Runs)
+		}
+	}
+	return results, scanner.Err()
+}
+
+// Read benchmark results from a file, "-" for standard input
+func readBenchmarkResults(filePath string) (map[string]*BenchmarkResult, error) {
+	if filePath == "-" {
+		return parseBenchmarkResults(os.Stdin)
+	}
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return parseBenchmarkResults(file)
+}
+
+// Relative change from a baseline value in percent
+func percentChange(baseline, current float64) float64 {
+	if baseline == 0 {
+		if current == 0 {
+			return 0
+		}
+		return 100
+	}
+	return 100 * (current - baseline) / baseline
+}
+
+// Print the benchmarks of both results side by side and return the names of those that got slower,
+// or allocate more, by more than threshold percent, and of those missing from the current results
+func compareBenchmarks(baseline, current map[string]*BenchmarkResult, threshold float64, out io.Writer) []string {
+	names := []string{}
+	for name := range baseline {
+		names = append(names, name)
+	}
+	for name := range current {
+		if _, exists := baseline[name]; !exists {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var regressions []string
+	for _, name := range names {
+		old, inBaseline := baseline[name]
+		now, inCurrent := current[name]
+		switch {
+		case !inCurrent:
+			// A renamed or deleted benchmark would otherwise pass unnoticed
+			fmt.Fprintf(out, "%-60s missing from the current results  MISSING\n", name)
+			regressions = append(regressions, name)
+			continue
+		case !inBaseline:
+			fmt.Fprintf(out, "%-60s new, %.0f ns/op\n", name, now.NsPerOp)
+			continue
+		}
+
+		timeChange := percentChange(old.NsPerOp, now.NsPerOp)
+		status := ""
+		if timeChange > threshold {
+			status = "  REGRESSION"
+		}
+		allocs := ""
+		if old.AllocsPerOp >= 0 && now.AllocsPerOp >= 0 {
+			allocsChange := percentChange(old.AllocsPerOp, now.AllocsPerOp)
+			allocs = fmt.Sprintf("  %.0f -> %.0f allocs/op (%+.1f%%)", old.AllocsPerOp, now.AllocsPerOp, allocsChange)
+			if allocsChange > threshold {
+				status = "  REGRESSION"
+			}
+		}
+		fmt.Fprintf(out, "%-60s %.0f -> %.0f ns/op (%+.1f%%)%s%s\n", name, old.NsPerOp, now.NsPerOp, timeChange, allocs, status)
+		if status != "" {
+			regressions = append(regressions, name)
+		}
+	}
+	return regressions
+}
+
+// bench-compare command: go run . bench-compare [-threshold percent] <baseline file> [current file]
+func runBenchCompare(args []string) {
+	flags := flag.NewFlagSet("bench-compare", flag.ExitOnError)
+	threshold := flags.Float64("threshold", 10, "percentage by which a benchmark may get slower or allocate more before it counts as a regression")
+	flags.Parse(args)
+	if flags.NArg() != 1 && flags.NArg() != 2 {
+		handleError("Usage: bench-compare [-threshold percent] <baseline file> [current file]")
+	}
+
+	baseline, err := readBenchmarkResults(flags.Arg(0))
+	if err != nil {
+		handleError(err.Error())
+	}
+	// The current results are read from standard input unless a file is given
+	currentFile := "-"
+	if flags.NArg() == 2 {
+		currentFile = flags.Arg(1)
+	}
+	current, err := readBenchmarkResults(currentFile)
+	if err != nil {
+		handleError(err.Error())
+	}
+	if len(baseline) == 0 {
+		handleError("No benchmark results in " + flags.Arg(0))
+	}
+
+	regressions := compareBenchmarks(baseline, current, *threshold, os.Stdout)
+	if len(regressions) > 0 {
+		fmt.Printf("%d of %d benchmarks regressed by more than %g%% or are missing\n", len(regressions), len(baseline), *threshold)
+		os.Exit(1)
+	}
+	fmt.Printf("No regressions by more than %g%%\n", *threshold)
+}
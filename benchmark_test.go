@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"testing"
+)
+
+// Generate a network for a benchmark, stopping the benchmark if the options are invalid
+func benchmarkNetwork(b *testing.B, options GeneratorOptions) (*Network, [2]string) {
+	b.Helper()
+	network, pairs, err := generateNetwork(options)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return network, pairs[0]
+}
+
+// Complete network on the given number of stations, every station connected to every other
+func completeNetwork(stations int) *Network {
+	network := newNetwork()
+	for i := 0; i < stations; i++ {
+		addStation(network, &Station{Name: generatedName(i), X: float64(i), Y: float64(i * i)})
+		for j := 0; j < i; j++ {
+			addConnection(network, generatedName(j), generatedName(i))
+		}
+	}
+	return network
+}
+
+func BenchmarkParseNetworkMap10000(b *testing.B) {
+	// 10000.map is over the default station limit
+	limits := ParseLimits{MaxLineLength: defaultParseLimits.MaxLineLength}
+	for i := 0; i < b.N; i++ {
+		if _, err := parseNetworkMapWithLimits("10000.map", limits); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseGeneratedMap(b *testing.B) {
+	for _, stations := range []int{100, 1000, 10000} {
+		b.Run(fmt.Sprintf("stations=%d", stations), func(b *testing.B) {
+			network, _ := benchmarkNetwork(b, GeneratorOptions{Family: "geometric", Stations: stations, Degree: 4, Connected: true, Seed: 1, Pairs: 1})
+			filePath := filepath.Join(b.TempDir(), "generated.map")
+			if err := writeNetworkFile(network, filePath); err != nil {
+				b.Fatal(err)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := parseNetworkMapWithLimits(filePath, ParseLimits{}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkPathExists(b *testing.B) {
+	for _, family := range []string{"grid", "geometric", "scale-free"} {
+		b.Run(family, func(b *testing.B) {
+			network, pair := benchmarkNetwork(b, GeneratorOptions{Family: family, Stations: 10000, Degree: 4, Connected: true, Seed: 1, Pairs: 1})
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if !pathExists(pair[0], pair[1], network, 1) {
+					b.Fatal("no path between", pair[0], pair[1])
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkDynamicDFS(b *testing.B) {
+	// dynamicDFS looks at every route between the stations, which grows quickly on dense networks
+	for _, stations := range []int{5, 6, 7} {
+		b.Run(fmt.Sprintf("complete=%d", stations), func(b *testing.B) {
+			network := completeNetwork(stations)
+			start, end := generatedName(0), generatedName(stations-1)
+			trains := newTrains(1, start)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				path := dynamicDFS(trains[0].Name, start, end, network, map[string]bool{}, map[[2]string]bool{}, trains, map[string]bool{start: true}, 1)
+				if path == nil {
+					b.Fatal("no path found")
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkSimulateTrains(b *testing.B) {
+	network, err := parseNetworkMap("network.map")
+	if err != nil {
+		b.Fatal(err)
+	}
+	// Routes of network.map, the planner slows down sharply with many trains on the larger ones
+	runs := []struct {
+		start, end string
+		trains     []int
+	}{
+		{"waterloo", "st_pancras", []int{1, 10, 100, 1000}},
+		{"small", "large", []int{1, 10}},
+	}
+	for _, run := range runs {
+		for _, numTrains := range run.trains {
+			b.Run(fmt.Sprintf("%s-%s/trains=%d", run.start, run.end, numTrains), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					result := simulateTrains(network, run.start, run.end, newTrains(numTrains, run.start), nil, io.Discard)
+					if !result.Completed {
+						b.Fatal("simulation did not complete")
+					}
+				}
+			})
+		}
+	}
+}
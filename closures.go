@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Regex for a closure line: a station or a connection followed by the first and last closed turn
+var closureRegex = regexp.MustCompile(`^\s*` + namePattern + `\s*(?:-\s*` + namePattern + `\s*)?,\s*([0-9]+)\s*,\s*([0-9]+)\s*(?:#.*)?$`)
+
+// Parse a single closure line, e.g. "victoria,3,5" or "waterloo-euston,1,2"
+func parseClosureLine(line string) (Closure, error) {
+	match := closureRegex.FindStringSubmatch(line)
+	if match == nil {
+		return Closure{}, errors.New("Invalid closure format: " + line)
+	}
+	from, errFrom := strconv.Atoi(match[3])
+	to, errTo := strconv.Atoi(match[4])
+	if errFrom != nil || errTo != nil || from < 1 || to < from {
+		return Closure{}, errors.New("Invalid closure turn window: " + line)
+	}
+	return Closure{Station1: unquoteName(match[1]), Station2: unquoteName(match[2]), From: from, To: to}, nil
+}
+
+// Read closures from a separate file and add them to the network
+// The file holds closure lines, optionally below a "closures:" header
+func parseClosures(filePath string, network *Network) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		// Ignore blank lines, comments and the section header
+		if line == "" || strings.HasPrefix(line, "#") || line == "closures:" {
+			continue
+		}
+
+		closure, err := parseClosureLine(line)
+		if err != nil {
+			return err
+		}
+		network.Closures = append(network.Closures, closure)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	return validateClosures(network)
+}
+
+// Check that every closure refers to an existing station or connection
+func validateClosures(network *Network) error {
+	for _, closure := range network.Closures {
+		if _, exists := network.Stations[closure.Station1]; !exists {
+			return errors.New("Closure of non-existing station: " + closure.Station1)
+		}
+		if closure.Station2 == "" {
+			continue
+		}
+		if _, exists := network.Stations[closure.Station2]; !exists {
+			return errors.New("Closure of non-existing station: " + closure.Station2)
+		}
+		if !contains(network.Connections[closure.Station1], closure.Station2) {
+			return errors.New("Closure of non-existing connection: " + closure.Station1 + "-" + closure.Station2)
+		}
+	}
+	return nil
+}
+
+// Check if a station is closed on the given turn
+func stationClosed(network *Network, station string, turn int) bool {
+	for _, closure := range network.Closures {
+		if closure.Station2 == "" && closure.Station1 == station && turn >= closure.From && turn <= closure.To {
+			return true
+		}
+	}
+	return false
+}
+
+// Check if the connection between two stations is closed on the given turn, in either direction
+func connectionClosed(network *Network, station1, station2 string, turn int) bool {
+	for _, closure := range network.Closures {
+		if closure.Station2 == "" || turn < closure.From || turn > closure.To {
+			continue
+		}
+		if (closure.Station1 == station1 && closure.Station2 == station2) || (closure.Station1 == station2 && closure.Station2 == station1) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check if a closure ended on the turn before the given one
+func closureLifted(network *Network, turn int) bool {
+	for _, closure := range network.Closures {
+		if closure.To == turn-1 {
+			return true
+		}
+	}
+	return false
+}
+
+// Check if a move from one station to the next is blocked by a closure on the given turn
+func moveClosed(network *Network, from, to string, turn int) bool {
+	return stationClosed(network, to, turn) || connectionClosed(network, from, to, turn)
+}
+
+// Check if a move is blocked by a closure in effect on the given turn or on any later one
+func moveClosedFrom(network *Network, from, to string, turn int) bool {
+	for _, closure := range network.Closures {
+		if closure.To < turn {
+			continue
+		}
+		if closure.Station2 == "" && closure.Station1 == to {
+			return true
+		}
+		if (closure.Station1 == from && closure.Station2 == to) || (closure.Station1 == to && closure.Station2 == from) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check if a path between two stations avoids every closure in effect on the given turn or later
+func openPathExists(start, end string, network *Network, turn int) bool {
+	visited := make(map[string]bool)
+	var dfs func(station string) bool
+	dfs = func(station string) bool {
+		if station == end {
+			return true
+		}
+		visited[station] = true
+		for _, neighbor := range network.Connections[station] {
+			if !visited[neighbor] && !moveClosedFrom(network, station, neighbor, turn) && dfs(neighbor) {
+				return true
+			}
+		}
+		return false
+	}
+	return dfs(start)
+}
+
+// Check if a route starting on the given turn runs into a closure, assuming the train moves every turn
+func routeClosed(network *Network, path []string, turn int) bool {
+	for i := 1; i < len(path); i++ {
+		if moveClosed(network, path[i-1], path[i], turn+i-1) {
+			return true
+		}
+	}
+	return false
+}
+
+// Last turn on which any closure is in effect, 0 if there are no closures
+func lastClosureTurn(network *Network) int {
+	last := 0
+	for _, closure := range network.Closures {
+		if closure.To > last {
+			last = closure.To
+		}
+	}
+	return last
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"container/heap"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Number of closest station pairs named when no path exists
+const closestPairsReported = 3
+
+// Split the network into connected components, largest first, each holding its station names in order
+func connectedComponents(network *Network) [][]string {
+	visited := make(map[string]bool)
+	var components [][]string
+	for _, name := range sortedStationNames(network) {
+		if visited[name] {
+			continue
+		}
+		visited[name] = true
+		component := []string{}
+		queue := []string{name}
+		for len(queue) > 0 {
+			station := queue[0]
+			queue = queue[1:]
+			component = append(component, station)
+			for _, neighbor := range network.Connections[station] {
+				if !visited[neighbor] {
+					visited[neighbor] = true
+					queue = append(queue, neighbor)
+				}
+			}
+		}
+		sort.Strings(component)
+		components = append(components, component)
+	}
+	sort.SliceStable(components, func(i, j int) bool {
+		return len(components[i]) > len(components[j])
+	})
+	return components
+}
+
+// Index of the component holding the given station, -1 if none does
+func componentOf(components [][]string, station string) int {
+	for i, component := range components {
+		if contains(component, station) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Mean radius of the Earth in kilometres
+const earthRadius = 6371.0
+
+// Distance between two stations: the great-circle distance in kilometres on geographic maps,
+// the straight-line distance otherwise
+func stationDistance(network *Network, station1, station2 *Station) float64 {
+	if !network.Geographic {
+		return math.Hypot(station1.X-station2.X, station1.Y-station2.Y)
+	}
+	// Haversine formula
+	latitude1, latitude2 := station1.Y*math.Pi/180, station2.Y*math.Pi/180
+	deltaLatitude := latitude2 - latitude1
+	deltaLongitude := (station2.X - station1.X) * math.Pi / 180
+	a := math.Sin(deltaLatitude/2)*math.Sin(deltaLatitude/2) + math.Cos(latitude1)*math.Cos(latitude2)*math.Sin(deltaLongitude/2)*math.Sin(deltaLongitude/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
+
+// stationPair struct to store a pair of stations and the distance between them
+type stationPair struct {
+	stations [2]string
+	distance float64
+	order    int // position in which the pair was measured, earlier pairs win ties
+}
+
+// Max-heap of station pairs, the farthest pair on top so it is the one dropped
+type pairHeap []stationPair
+
+func (h pairHeap) Len() int { return len(h) }
+func (h pairHeap) Less(i, j int) bool {
+	if h[i].distance != h[j].distance {
+		return h[i].distance > h[j].distance
+	}
+	return h[i].order > h[j].order
+}
+func (h pairHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *pairHeap) Push(x interface{}) { *h = append(*h, x.(stationPair)) }
+func (h *pairHeap) Pop() interface{} {
+	old := *h
+	pair := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return pair
+}
+
+// Find the closest pairs of stations, one from each component, ordered by distance
+// Only the count closest pairs are kept while the pairs are measured, each distance is computed once.
+func closestPairs(network *Network, component1, component2 []string, count int) [][2]string {
+	if count <= 0 {
+		return nil
+	}
+	closest := &pairHeap{}
+	order := 0
+	for _, name1 := range component1 {
+		station1 := network.Stations[name1]
+		for _, name2 := range component2 {
+			pair := stationPair{[2]string{name1, name2}, stationDistance(network, station1, network.Stations[name2]), order}
+			order++
+			if closest.Len() < count {
+				heap.Push(closest, pair)
+			} else if pair.distance < (*closest)[0].distance {
+				(*closest)[0] = pair
+				heap.Fix(closest, 0)
+			}
+		}
+	}
+
+	// Popping the max-heap gives the farthest pair first
+	pairs := make([][2]string, closest.Len())
+	for i := len(pairs) - 1; i >= 0; i-- {
+		pairs[i] = heap.Pop(closest).(stationPair).stations
+	}
+	return pairs
+}
+
+// Explain why there is no path between two stations: the components they are in and
+// the closest stations that could be connected to join them
+// The stations must be in different components, closures never make a path impossible for good.
+func noPathDiagnostics(network *Network, startStation, endStation string) string {
+	components := connectedComponents(network)
+	start := componentOf(components, startStation)
+	end := componentOf(components, endStation)
+
+	lines := []string{fmt.Sprintf("No path exists between the start station: '%s' and end station: '%s'", startStation, endStation)}
+	lines = append(lines,
+		fmt.Sprintf("  '%s' is in component %d of %d with %d stations", startStation, start+1, len(components), len(components[start])),
+		fmt.Sprintf("  '%s' is in component %d of %d with %d stations", endStation, end+1, len(components), len(components[end])),
+		"  Closest stations between the two components:")
+	unit := ""
+	if network.Geographic {
+		unit = " km"
+	}
+	for _, pair := range closestPairs(network, components[start], components[end], closestPairsReported) {
+		distance := stationDistance(network, network.Stations[pair[0]], network.Stations[pair[1]])
+		lines = append(lines, fmt.Sprintf("    %s - %s (distance %.2f%s)", pair[0], pair[1], distance, unit))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// components command: go run . components <map>
+func runComponents(args []string) {
+	if len(args) != 1 {
+		handleError("Usage: components <map file>")
+	}
+
+	network, err := parseNetworkMap(args[0])
+	if err != nil {
+		handleError(err.Error())
+	}
+
+	components := connectedComponents(network)
+	fmt.Printf("Components: %d\n", len(components))
+	for i, component := range components {
+		fmt.Printf("  %d (%d stations): %s\n", i+1, len(component), strings.Join(component, ", "))
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Read the constraints file and set the via and avoid station lists of the given trains
+//
+// Every line names a train, the kind of constraint and the stations it applies to:
+//
+//	T1 via mozart verdi # must pass mozart and then verdi
+//	T2 avoid handel     # must never enter handel
+//	T3 avoid "King's Cross"
+func parseConstraints(filePath string, trains []*Train) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	trainsByName := make(map[string]*Train)
+	for _, train := range trains {
+		trainsByName[train.Name] = train
+	}
+
+	// Regex to allow flexible whitespace and comments
+	constraintRegex := regexp.MustCompile(`^\s*([a-zA-Z0-9_]+)\s+(via|avoid)((?:\s+` + namePattern + `)+)\s*(?:#.*)?$`)
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		// Ignore blank lines and comments
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		match := constraintRegex.FindStringSubmatch(line)
+		if match == nil {
+			return errors.New("Invalid constraint format: " + line)
+		}
+		train, exists := trainsByName[match[1]]
+		if !exists {
+			return errors.New("Constraint for non-existing train: " + match[1])
+		}
+		var stations []string
+		for _, token := range nameRegex.FindAllString(match[3], -1) {
+			stations = append(stations, unquoteName(token))
+		}
+		if match[2] == "via" {
+			train.Via = append(train.Via, stations...)
+		} else {
+			train.Avoid = append(train.Avoid, stations...)
+		}
+	}
+
+	return scanner.Err()
+}
+
+// Check if a station can be reached from another without entering any of the avoided stations
+func reachableAvoiding(start, end string, network *Network, avoid []string) bool {
+	visited := map[string]bool{start: true}
+	queue := []string{start}
+	for len(queue) > 0 {
+		station := queue[0]
+		queue = queue[1:]
+		if station == end {
+			return true
+		}
+		for _, neighbor := range network.Connections[station] {
+			if !visited[neighbor] && !contains(avoid, neighbor) {
+				visited[neighbor] = true
+				queue = append(queue, neighbor)
+			}
+		}
+	}
+	return false
+}
+
+// Check that the via and avoid stations of every train can be satisfied, naming the constraint that cannot
+func checkTrainConstraints(network *Network, startStation, endStation string, trains []*Train) error {
+	for _, train := range trains {
+		for _, station := range append(append([]string{}, train.Via...), train.Avoid...) {
+			if _, exists := network.Stations[station]; !exists {
+				return fmt.Errorf("Train %s has a constraint on non-existing station: %s", train.Name, station)
+			}
+		}
+		for _, station := range train.Via {
+			if station == startStation || station == endStation {
+				return fmt.Errorf("Train %s has a terminal as via station: %s", train.Name, station)
+			}
+			if contains(train.Avoid, station) {
+				return fmt.Errorf("Train %s must both pass and avoid station: %s", train.Name, station)
+			}
+		}
+		if contains(train.Avoid, startStation) || contains(train.Avoid, endStation) {
+			return fmt.Errorf("Train %s cannot avoid the terminals '%s' and '%s'", train.Name, startStation, endStation)
+		}
+
+		// Every stretch between the terminals and the via stations must be passable without avoided stations
+		stops := append(append([]string{startStation}, train.Via...), endStation)
+		if train.Legs > 1 {
+			stops = append(stops, startStation)
+		}
+		for i := 1; i < len(stops); i++ {
+			if reachableAvoiding(stops[i-1], stops[i], network, train.Avoid) {
+				continue
+			}
+			if len(train.Avoid) > 0 && reachableAvoiding(stops[i-1], stops[i], network, nil) {
+				return fmt.Errorf("Train %s cannot get from '%s' to '%s' without entering an avoided station (avoid %s)", train.Name, stops[i-1], stops[i], strings.Join(train.Avoid, " "))
+			}
+			return fmt.Errorf("Train %s cannot get from '%s' to '%s' to pass its via stations (via %s)", train.Name, stops[i-1], stops[i], strings.Join(train.Via, " "))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Write the network to a file, the format is chosen by the file extension
+func writeNetworkFile(network *Network, filePath string) error {
+	file, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".json":
+		err = writeNetworkJSON(network, file)
+	case ".geojson":
+		err = writeNetworkGeoJSON(network, file)
+	case ".dot", ".gv":
+		err = writeNetworkDOT(network, file, nil)
+	default:
+		err = writeNetworkText(network, file)
+	}
+	if err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// convert command: go run . convert <input map> <output map>
+func runConvert(args []string) {
+	if len(args) != 2 {
+		handleError("Usage: convert <input map file> <output map file>")
+	}
+
+	network, err := parseNetworkMap(args[0])
+	if err != nil {
+		handleError(err.Error())
+	}
+	if err := writeNetworkFile(network, args[1]); err != nil {
+		handleError(err.Error())
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// MapDiff struct to store the semantic differences between two versions of a map
+// Stations with the same coordinates but different names count as renamed, stations with the same
+// name but different coordinates as moved. Connections are compared after applying the renames.
+type MapDiff struct {
+	AddedStations      []string
+	RemovedStations    []string
+	RenamedStations    [][2]string // old name, new name
+	MovedStations      []string
+	AddedConnections   [][2]string
+	RemovedConnections [][2]string
+}
+
+// Compare two versions of a map
+func diffNetworks(oldNetwork, newNetwork *Network) MapDiff {
+	var diff MapDiff
+
+	// Stations only in one of the maps, renames are matched by coordinates
+	newAt := make(map[string]string)
+	for _, name := range newNetwork.StationOrder {
+		station := newNetwork.Stations[name]
+		newAt[formatCoordinate(station.X)+","+formatCoordinate(station.Y)] = name
+	}
+	renamed := make(map[string]string)
+	renamedTo := make(map[string]bool)
+	for _, name := range oldNetwork.StationOrder {
+		if _, exists := newNetwork.Stations[name]; exists {
+			continue
+		}
+		station := oldNetwork.Stations[name]
+		newName, exists := newAt[formatCoordinate(station.X)+","+formatCoordinate(station.Y)]
+		if _, stillOld := oldNetwork.Stations[newName]; exists && !stillOld && !renamedTo[newName] {
+			renamed[name] = newName
+			renamedTo[newName] = true
+			diff.RenamedStations = append(diff.RenamedStations, [2]string{name, newName})
+			continue
+		}
+		diff.RemovedStations = append(diff.RemovedStations, name)
+	}
+	for _, name := range newNetwork.StationOrder {
+		if _, exists := oldNetwork.Stations[name]; !exists && !renamedTo[name] {
+			diff.AddedStations = append(diff.AddedStations, name)
+		}
+	}
+
+	// Stations kept under the same name but at new coordinates
+	for _, name := range oldNetwork.StationOrder {
+		oldStation := oldNetwork.Stations[name]
+		if newStation, exists := newNetwork.Stations[name]; exists && (oldStation.X != newStation.X || oldStation.Y != newStation.Y) {
+			diff.MovedStations = append(diff.MovedStations, name)
+		}
+	}
+
+	// Connections, with the old names translated to the new ones
+	newName := func(name string) string {
+		if renamedName, exists := renamed[name]; exists {
+			return renamedName
+		}
+		return name
+	}
+	oldConnections := make(map[[2]string]bool)
+	for _, connection := range oldNetwork.ConnectionOrder {
+		station1, station2 := newName(connection[0]), newName(connection[1])
+		oldConnections[connectionKey(station1, station2)] = true
+		if !contains(newNetwork.Connections[station1], station2) {
+			diff.RemovedConnections = append(diff.RemovedConnections, connection)
+		}
+	}
+	for _, connection := range newNetwork.ConnectionOrder {
+		if !oldConnections[connectionKey(connection[0], connection[1])] {
+			diff.AddedConnections = append(diff.AddedConnections, connection)
+		}
+	}
+
+	return diff
+}
+
+// Number of connections on the shortest path between two stations, -1 if there is none
+func shortestDistance(network *Network, startStation, endStation string) int {
+	if _, exists := network.Stations[startStation]; !exists {
+		return -1
+	}
+	distance := map[string]int{startStation: 0}
+	queue := []string{startStation}
+	for len(queue) > 0 {
+		station := queue[0]
+		queue = queue[1:]
+		if station == endStation {
+			return distance[station]
+		}
+		for _, neighbor := range network.Connections[station] {
+			if _, seen := distance[neighbor]; !seen {
+				distance[neighbor] = distance[station] + 1
+				queue = append(queue, neighbor)
+			}
+		}
+	}
+	return -1
+}
+
+// Station pairs given as repeated "start:end" flags
+type stationPairs [][2]string
+
+func (pairs *stationPairs) String() string {
+	parts := make([]string, len(*pairs))
+	for i, pair := range *pairs {
+		parts[i] = pair[0] + ":" + pair[1]
+	}
+	return strings.Join(parts, " ")
+}
+
+func (pairs *stationPairs) Set(value string) error {
+	start, end, found := strings.Cut(value, ":")
+	if !found || start == "" || end == "" {
+		return fmt.Errorf("expected start:end, got %s", value)
+	}
+	*pairs = append(*pairs, [2]string{start, end})
+	return nil
+}
+
+// Describe a route length for the diff output
+func describeDistance(distance int) string {
+	if distance == -1 {
+		return "no path"
+	}
+	return fmt.Sprintf("%d connections", distance)
+}
+
+// diff command: go run . diff [-route start:end ...] <old map> <new map>
+func runDiff(args []string) {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	var routes stationPairs
+	flags.Var(&routes, "route", "compare the shortest route between two stations, as start:end with the old names (repeatable)")
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		handleError("Usage: diff [-route start:end ...] <old map file> <new map file>")
+	}
+
+	oldNetwork, err := parseNetworkMap(flags.Arg(0))
+	if err != nil {
+		handleError(flags.Arg(0) + ": " + err.Error())
+	}
+	newNetwork, err := parseNetworkMap(flags.Arg(1))
+	if err != nil {
+		handleError(flags.Arg(1) + ": " + err.Error())
+	}
+
+	diff := diffNetworks(oldNetwork, newNetwork)
+	fmt.Printf("Stations added (%d): %s\n", len(diff.AddedStations), strings.Join(diff.AddedStations, ", "))
+	fmt.Printf("Stations removed (%d): %s\n", len(diff.RemovedStations), strings.Join(diff.RemovedStations, ", "))
+	renames := make([]string, len(diff.RenamedStations))
+	for i, rename := range diff.RenamedStations {
+		renames[i] = rename[0] + " -> " + rename[1]
+	}
+	fmt.Printf("Stations renamed (%d): %s\n", len(renames), strings.Join(renames, ", "))
+	moves := make([]string, len(diff.MovedStations))
+	for i, name := range diff.MovedStations {
+		oldStation, newStation := oldNetwork.Stations[name], newNetwork.Stations[name]
+		moves[i] = fmt.Sprintf("%s (%s,%s) -> (%s,%s)", name, formatCoordinate(oldStation.X), formatCoordinate(oldStation.Y), formatCoordinate(newStation.X), formatCoordinate(newStation.Y))
+	}
+	fmt.Printf("Stations moved (%d): %s\n", len(moves), strings.Join(moves, ", "))
+	fmt.Printf("Connections added (%d): %s\n", len(diff.AddedConnections), formatConnections(diff.AddedConnections))
+	fmt.Printf("Connections removed (%d): %s\n", len(diff.RemovedConnections), formatConnections(diff.RemovedConnections))
+
+	if len(routes) == 0 {
+		return
+	}
+	renamed := make(map[string]string)
+	for _, rename := range diff.RenamedStations {
+		renamed[rename[0]] = rename[1]
+	}
+	fmt.Println("Routes:")
+	for _, route := range routes {
+		newStart, newEnd := route[0], route[1]
+		if name, exists := renamed[newStart]; exists {
+			newStart = name
+		}
+		if name, exists := renamed[newEnd]; exists {
+			newEnd = name
+		}
+		before := shortestDistance(oldNetwork, route[0], route[1])
+		after := shortestDistance(newNetwork, newStart, newEnd)
+		change := "unchanged"
+		switch {
+		case before == after:
+		case before == -1:
+			change = "now connected"
+		case after == -1:
+			change = "no longer connected"
+		case after > before:
+			change = fmt.Sprintf("longer by %d", after-before)
+		default:
+			change = fmt.Sprintf("shorter by %d", before-after)
+		}
+		fmt.Printf("  %s -> %s: %s -> %s (%s)\n", route[0], route[1], describeDistance(before), describeDistance(after), change)
+	}
+}
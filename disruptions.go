@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+)
+
+// DisruptionModel struct to store the chances of random failures during a simulation
+// Every probability is the chance per turn that one such disruption happens
+type DisruptionModel struct {
+	SegmentProbability float64 // a random connection is blocked
+	StationProbability float64 // a random station other than the start and end is closed
+	HoldProbability    float64 // a random train on its way is held at its station
+	Duration           int     // number of turns each disruption lasts
+	Seed               int64
+	rng                *rand.Rand
+}
+
+// Create a disruption model with its own random source seeded with the given seed
+func newDisruptionModel(segmentProbability, stationProbability, holdProbability float64, duration int, seed int64) *DisruptionModel {
+	return &DisruptionModel{
+		SegmentProbability: segmentProbability,
+		StationProbability: stationProbability,
+		HoldProbability:    holdProbability,
+		Duration:           duration,
+		Seed:               seed,
+		rng:                rand.New(rand.NewSource(seed)),
+	}
+}
+
+// Station names in a fixed order, so the same seed always picks the same stations
+func sortedStationNames(network *Network) []string {
+	names := make([]string, 0, len(network.Stations))
+	for name := range network.Stations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Draw the disruptions of a turn and apply them as closures and train holds
+func applyDisruptions(model *DisruptionModel, network *Network, trains []*Train, startStation, endStation string, turn int, out io.Writer) {
+	names := sortedStationNames(network)
+	lastTurn := turn + model.Duration - 1
+
+	// Block a random connection
+	if model.rng.Float64() < model.SegmentProbability {
+		station1 := names[model.rng.Intn(len(names))]
+		if neighbors := network.Connections[station1]; len(neighbors) > 0 {
+			station2 := neighbors[model.rng.Intn(len(neighbors))]
+			network.Closures = append(network.Closures, Closure{Station1: station1, Station2: station2, From: turn, To: lastTurn})
+			fmt.Fprintf(out, "Disruption: %s-%s blocked until turn %d\n", quoteName(station1), quoteName(station2), lastTurn)
+		}
+	}
+
+	// Close a random station, the start and end stations are never closed
+	if model.rng.Float64() < model.StationProbability {
+		station := names[model.rng.Intn(len(names))]
+		if station != startStation && station != endStation {
+			network.Closures = append(network.Closures, Closure{Station1: station, From: turn, To: lastTurn})
+			fmt.Fprintf(out, "Disruption: %s closed until turn %d\n", quoteName(station), lastTurn)
+		}
+	}
+
+	// Hold a random train that is on its way
+	if model.rng.Float64() < model.HoldProbability {
+		train := trains[model.rng.Intn(len(trains))]
+		if train.Current != startStation && train.Current != endStation {
+			train.HeldUntil = lastTurn
+			fmt.Fprintf(out, "Disruption: %s held at %s until turn %d\n", train.Name, quoteName(train.Current), lastTurn)
+		}
+	}
+}
+
+// Copy the trains back to the start station, keeping their timetable, number of legs and constraints
+func resetTrains(trains []*Train, startStation string) []*Train {
+	copies := make([]*Train, len(trains))
+	for i, train := range trains {
+		copies[i] = &Train{Name: train.Name, Current: startStation, Departure: train.Departure, Deadline: train.Deadline, Legs: train.Legs, Via: train.Via, Avoid: train.Avoid}
+	}
+	return copies
+}
+
+// Run the simulation once per seed, starting from the model's seed, and print the distribution
+// of completion turns and how often a run ended stuck
+func runMonteCarlo(network *Network, startStation, endStation string, trains []*Train, model *DisruptionModel, runs int, out io.Writer) {
+	completionTurns := make(map[int]int)
+	var turns []int
+	stuckRuns := 0
+
+	for i := 0; i < runs; i++ {
+		seed := model.Seed + int64(i)
+		runModel := newDisruptionModel(model.SegmentProbability, model.StationProbability, model.HoldProbability, model.Duration, seed)
+		result := simulateTrains(network, startStation, endStation, resetTrains(trains, startStation), runModel, io.Discard)
+		if !result.Completed {
+			stuckRuns++
+			continue
+		}
+		completionTurns[result.Turns]++
+		turns = append(turns, result.Turns)
+	}
+
+	fmt.Fprintf(out, "Runs: %d (seeds %d to %d)\n", runs, model.Seed, model.Seed+int64(runs)-1)
+	fmt.Fprintf(out, "Stuck: %d (%.1f%%)\n", stuckRuns, 100*float64(stuckRuns)/float64(runs))
+	if len(turns) == 0 {
+		return
+	}
+
+	sort.Ints(turns)
+	total := 0
+	for _, t := range turns {
+		total += t
+	}
+	fmt.Fprintf(out, "Completion turns: min %d, median %d, mean %.2f, max %d\n", turns[0], turns[len(turns)/2], float64(total)/float64(len(turns)), turns[len(turns)-1])
+	for t := turns[0]; t <= turns[len(turns)-1]; t++ {
+		if completionTurns[t] > 0 {
+			fmt.Fprintf(out, "  %4d turns: %d\n", t, completionTurns[t])
+		}
+	}
+}
@@ -0,0 +1,512 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Colours used for the routes in exported DOT graphs, repeated when there are more routes
+var routeColours = []string{"red", "blue", "green3", "darkorange", "purple", "deeppink", "cyan4", "gold3"}
+
+// dotScanner struct to split DOT source into tokens as it is read: identifiers, numbers, quoted strings
+// and punctuation. Comments are dropped and quoted strings keep their opening quote so they can be
+// told apart. Tokens longer than maxLength bytes are rejected, 0 allows tokens of any length.
+type dotScanner struct {
+	reader    *bufio.Reader
+	maxLength int
+	peeked    []string
+}
+
+func newDOTScanner(reader io.Reader, maxLength int) *dotScanner {
+	return &dotScanner{reader: bufio.NewReader(reader), maxLength: maxLength}
+}
+
+// Token n places after the next one without reading past it, "" at the end of the source
+func (s *dotScanner) peek(n int) (string, error) {
+	for len(s.peeked) <= n {
+		token, err := s.scan()
+		if err != nil || token == "" {
+			return "", err
+		}
+		s.peeked = append(s.peeked, token)
+	}
+	return s.peeked[n], nil
+}
+
+// Next token, "" at the end of the source
+func (s *dotScanner) next() (string, error) {
+	token, err := s.peek(0)
+	if token != "" {
+		s.peeked = s.peeked[1:]
+	}
+	return token, err
+}
+
+// Read the next token from the source, "" at the end of it
+func (s *dotScanner) scan() (string, error) {
+	for {
+		r, _, err := s.reader.ReadRune()
+		if err == io.EOF {
+			return "", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case unicode.IsSpace(r):
+		case r == '#':
+			if err := s.skipPast("\n", ""); err != nil {
+				return "", err
+			}
+		case r == '/':
+			following, _, _ := s.reader.ReadRune()
+			switch following {
+			case '/':
+				if err := s.skipPast("\n", ""); err != nil {
+					return "", err
+				}
+			case '*':
+				if err := s.skipPast("*/", "Unterminated comment in DOT graph"); err != nil {
+					return "", err
+				}
+			default:
+				return "", fmt.Errorf("Unexpected character in DOT graph: %q", r)
+			}
+		case r == '"':
+			return s.quoted()
+		case r == '-':
+			following, _, err := s.reader.ReadRune()
+			if err == nil && (following == '-' || following == '>') {
+				return "--", nil
+			}
+			if err == nil {
+				s.reader.UnreadRune()
+			}
+			return s.identifier(r)
+		case strings.ContainsRune("{}[]=;,:", r):
+			return string(r), nil
+		case r == '_' || r == '.' || unicode.IsLetter(r) || unicode.IsDigit(r):
+			return s.identifier(r)
+		default:
+			return "", fmt.Errorf("Unexpected character in DOT graph: %q", r)
+		}
+	}
+}
+
+// Skip the source up to and including end, the end of the source ends a comment unless unterminated is given
+func (s *dotScanner) skipPast(end, unterminated string) error {
+	matched := 0
+	for matched < len(end) {
+		b, err := s.reader.ReadByte()
+		if err == io.EOF && unterminated == "" {
+			return nil
+		}
+		if err == io.EOF {
+			return errors.New(unterminated)
+		}
+		if err != nil {
+			return err
+		}
+		switch {
+		case b == end[matched]:
+			matched++
+		case b == end[0]:
+			matched = 1
+		default:
+			matched = 0
+		}
+	}
+	return nil
+}
+
+// Read the rest of a quoted string, its opening quote kept as the marker of a quoted token
+func (s *dotScanner) quoted() (string, error) {
+	var token strings.Builder
+	token.WriteByte('"')
+	for {
+		r, _, err := s.reader.ReadRune()
+		if err == io.EOF {
+			return "", errors.New("Unterminated string in DOT graph")
+		}
+		if err != nil {
+			return "", err
+		}
+		if r == '"' {
+			return token.String(), nil
+		}
+		if r == '\\' {
+			if r, _, err = s.reader.ReadRune(); err == io.EOF {
+				return "", errors.New("Unterminated string in DOT graph")
+			}
+		}
+		token.WriteRune(r)
+		if err := s.checkLength(token.Len() - 1); err != nil {
+			return "", err
+		}
+	}
+}
+
+// Read the rest of an identifier or number starting with first
+func (s *dotScanner) identifier(first rune) (string, error) {
+	var token strings.Builder
+	token.WriteRune(first)
+	for {
+		r, _, err := s.reader.ReadRune()
+		if err == io.EOF {
+			return token.String(), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if r != '_' && r != '.' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			s.reader.UnreadRune()
+			return token.String(), nil
+		}
+		token.WriteRune(r)
+		if err := s.checkLength(token.Len()); err != nil {
+			return "", err
+		}
+	}
+}
+
+// Reject a token that has grown past the length limit
+func (s *dotScanner) checkLength(length int) error {
+	if s.maxLength > 0 && length > s.maxLength {
+		return fmt.Errorf("DOT graph contains a value longer than %s bytes", formatCount(s.maxLength))
+	}
+	return nil
+}
+
+// Value of a token with the quote marker of quoted strings removed
+func dotValue(token string) string {
+	return strings.TrimPrefix(token, "\"")
+}
+
+// Parse a network drawn as a Graphviz DOT graph
+// Every node needs a pos attribute ("x,y", optionally pinned with "!") whose values become the
+// station coordinates. Edges become connections, except the route overlays
+// marked with class="route". Other attributes are kept as attributes of the stations and connections.
+// The graph attribute coordinates="geographic" marks the positions as longitude/latitude, and the
+// graph attribute closures holds closure lines as in the map format, one per line.
+func parseNetworkDOT(reader io.Reader, limits ParseLimits) (*Network, error) {
+	// The graph is read token by token, and stations and connections are counted as they appear
+	tokens := newDOTScanner(reader, limits.MaxLineLength)
+
+	network := newNetwork()
+	// The coordinate system and the closures are graph attributes, given alone or in a graph [...] list
+	graphAttribute := func(key, value string) error {
+		switch key {
+		case "coordinates":
+			switch value {
+			case "planar":
+				network.Geographic = false
+			case "geographic":
+				network.Geographic = true
+			default:
+				return errors.New("Invalid coordinates in DOT graph: " + value)
+			}
+		case "closures":
+			for _, line := range strings.Split(value, "\n") {
+				if strings.TrimSpace(line) == "" {
+					continue
+				}
+				closure, err := parseClosureLine(line)
+				if err != nil {
+					return errors.New(err.Error() + " in DOT graph")
+				}
+				network.Closures = append(network.Closures, closure)
+			}
+		}
+		return nil
+	}
+	positions := make(map[string][2]float64)
+	nodeAttributes := make(map[string][]Attribute)
+	var nodes []string
+	seen := make(map[string]bool)
+	addNode := func(name string) error {
+		if !seen[name] {
+			seen[name] = true
+			nodes = append(nodes, name)
+		}
+		return checkLimit(len(nodes), limits.MaxStations, "stations")
+	}
+
+	// Read an attribute list starting at the "[" that is the next token
+	readAttributes := func() ([]Attribute, error) {
+		var attributes []Attribute
+		tokens.next()
+		for {
+			key, err := tokens.next()
+			switch {
+			case err != nil:
+				return nil, err
+			case key == "":
+				return nil, errors.New("Unterminated attribute list in DOT graph")
+			case key == "]":
+				return attributes, nil
+			case key == "," || key == ";":
+				continue
+			}
+			equals, err := tokens.next()
+			if err != nil {
+				return nil, err
+			}
+			value, err := tokens.next()
+			if err != nil {
+				return nil, err
+			}
+			if equals != "=" || value == "" {
+				return nil, errors.New("Invalid attribute list in DOT graph")
+			}
+			// As in Graphviz, an attribute given twice takes the last value
+			attributes = append(withoutAttribute(attributes, dotValue(key)), Attribute{Key: dotValue(key), Value: dotValue(value)})
+		}
+	}
+
+	// Skip the graph header up to the opening brace
+	for {
+		token, err := tokens.next()
+		if err != nil {
+			return nil, err
+		}
+		if token == "" {
+			return nil, errors.New("DOT graph does not contain a '{' body")
+		}
+		if token == "{" {
+			break
+		}
+	}
+
+	for {
+		token, err := tokens.next()
+		if err != nil {
+			return nil, err
+		}
+		if token == "" {
+			break
+		}
+		following, err := tokens.peek(0)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case token == "}" || token == "{" || token == ";" || token == ",":
+		case token == "graph" || token == "node" || token == "edge" || token == "subgraph":
+			// Default attributes and subgraph names carry no stations
+			if following == "[" {
+				attributes, err := readAttributes()
+				if err != nil {
+					return nil, err
+				}
+				for i := 0; token == "graph" && i < len(attributes); i++ {
+					if err := graphAttribute(attributes[i].Key, attributes[i].Value); err != nil {
+						return nil, err
+					}
+				}
+			} else if token == "subgraph" && following != "" && following != "{" {
+				tokens.next()
+			}
+		case following == "=":
+			// Graph attribute such as rankdir=LR
+			tokens.next()
+			value, err := tokens.next()
+			if err != nil {
+				return nil, err
+			}
+			if value != "" {
+				if err := graphAttribute(dotValue(token), dotValue(value)); err != nil {
+					return nil, err
+				}
+			}
+		default:
+			// Node or edge statement: a chain of names joined by "--"
+			chain := []string{dotValue(token)}
+			for {
+				edge, err := tokens.peek(0)
+				if err != nil {
+					return nil, err
+				}
+				name, err := tokens.peek(1)
+				if err != nil {
+					return nil, err
+				}
+				if edge != "--" || name == "" {
+					break
+				}
+				tokens.next()
+				tokens.next()
+				chain = append(chain, dotValue(name))
+			}
+			var attributes []Attribute
+			if next, err := tokens.peek(0); err != nil {
+				return nil, err
+			} else if next == "[" {
+				if attributes, err = readAttributes(); err != nil {
+					return nil, err
+				}
+			}
+			for _, name := range chain {
+				if err := addNode(name); err != nil {
+					return nil, err
+				}
+			}
+			if len(chain) == 1 {
+				if pos, exists := attributeValue(attributes, "pos"); exists {
+					position, err := parseDOTPosition(pos)
+					if err != nil {
+						return nil, errors.New("Invalid pos attribute for station " + chain[0] + ": " + pos)
+					}
+					positions[chain[0]] = position
+					attributes = withoutAttribute(attributes, "pos")
+				}
+				if len(attributes) > 0 {
+					nodeAttributes[chain[0]] = attributes
+				}
+				continue
+			}
+			// Route overlays written by writeNetworkDOT are not part of the network
+			if class, _ := attributeValue(attributes, "class"); class == "route" {
+				continue
+			}
+			for j := 1; j < len(chain); j++ {
+				network.ConnectionOrder = append(network.ConnectionOrder, [2]string{chain[j-1], chain[j]})
+				if len(attributes) > 0 {
+					network.ConnectionAttributes[connectionKey(chain[j-1], chain[j])] = attributes
+				}
+			}
+			if err := checkLimit(len(network.ConnectionOrder), limits.MaxConnections, "connections"); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Nodes become stations once the whole graph is read, as an edge may use a node before its position is given
+	for _, name := range nodes {
+		position, exists := positions[name]
+		if !exists {
+			return nil, errors.New("Station without pos attribute in DOT graph: " + name)
+		}
+		addStation(network, &Station{Name: name, X: position[0], Y: position[1], Attributes: nodeAttributes[name]})
+	}
+
+	return validatedNetwork(network, limits)
+}
+
+// Parse a DOT position "x,y" or "x,y!" into coordinates
+func parseDOTPosition(pos string) ([2]float64, error) {
+	parts := strings.Split(strings.TrimSuffix(strings.TrimSpace(pos), "!"), ",")
+	if len(parts) != 2 {
+		return [2]float64{}, errors.New("invalid position")
+	}
+	var position [2]float64
+	for i, part := range parts {
+		value, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return [2]float64{}, err
+		}
+		position[i] = value
+	}
+	return position, nil
+}
+
+// Quote a name or value for DOT, escaping only quotes and backslashes as Graphviz and dotScanner read them
+// Other characters, including non-ASCII and control characters, are written as they are.
+func dotQuote(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
+// Attributes as a DOT attribute list, following other attributes when the list is not the first one
+func dotAttributes(attributes []Attribute, following bool) string {
+	parts := make([]string, len(attributes))
+	for i, attribute := range attributes {
+		parts[i] = dotQuote(attribute.Key) + "=" + dotQuote(attribute.Value)
+	}
+	text := strings.Join(parts, ", ")
+	if following && text != "" {
+		text = ", " + text
+	}
+	return text
+}
+
+// Route taken by one or more trains
+type trainRoute struct {
+	Stations []string
+	Trains   []string
+}
+
+// Group the trains by the route they travelled, most used route first
+func trainRoutes(trains []*Train) []trainRoute {
+	var routes []trainRoute
+	index := make(map[string]int)
+	for _, train := range trains {
+		if len(train.Route) < 2 {
+			continue
+		}
+		key := strings.Join(train.Route, "\x00")
+		if i, exists := index[key]; exists {
+			routes[i].Trains = append(routes[i].Trains, train.Name)
+			continue
+		}
+		index[key] = len(routes)
+		routes = append(routes, trainRoute{Stations: train.Route, Trains: []string{train.Name}})
+	}
+	sort.SliceStable(routes, func(i, j int) bool {
+		return len(routes[i].Trains) > len(routes[j].Trains)
+	})
+	return routes
+}
+
+// Write the network as a Graphviz DOT graph with every station pinned at its coordinates
+// Routes, when given, are drawn as coloured edges labelled with the number of trains on them
+func writeNetworkDOT(network *Network, writer io.Writer, routes []trainRoute) error {
+	out := bufio.NewWriter(writer)
+
+	fmt.Fprintln(out, "graph network {")
+	if network.Geographic {
+		fmt.Fprintln(out, "  coordinates=\"geographic\";")
+	}
+	if len(network.Closures) > 0 {
+		closures := make([]string, len(network.Closures))
+		for i, closure := range network.Closures {
+			closures[i] = closureText(closure)
+		}
+		fmt.Fprintf(out, "  closures=%s;\n", dotQuote(strings.Join(closures, "\n")))
+	}
+	fmt.Fprintln(out, "  node [shape=circle];")
+	for _, name := range network.StationOrder {
+		station := network.Stations[name]
+		fmt.Fprintf(out, "  %s [pos=\"%s,%s!\"%s];\n", dotQuote(station.Name), formatCoordinate(station.X), formatCoordinate(station.Y), dotAttributes(station.Attributes, true))
+	}
+	for _, connection := range network.ConnectionOrder {
+		attributes := dotAttributes(connectionAttributes(network, connection[0], connection[1]), false)
+		if attributes != "" {
+			attributes = " [" + attributes + "]"
+		}
+		fmt.Fprintf(out, "  %s -- %s%s;\n", dotQuote(connection[0]), dotQuote(connection[1]), attributes)
+	}
+
+	for i, route := range routes {
+		colour := routeColours[i%len(routeColours)]
+		label := fmt.Sprintf("%d trains: %s", len(route.Trains), strings.Join(route.Trains, " "))
+		if len(route.Trains) == 1 {
+			label = "1 train: " + route.Trains[0]
+		}
+		fmt.Fprintf(out, "  // route %d: %s\n", i+1, strings.Join(route.Stations, " "))
+		for j := 1; j < len(route.Stations); j++ {
+			attributes := fmt.Sprintf("class=route, color=%s, penwidth=3", colour)
+			if j == 1 {
+				attributes += ", label=" + dotQuote(label) + ", fontcolor=" + colour
+			}
+			fmt.Fprintf(out, "  %s -- %s [%s];\n", dotQuote(route.Stations[j-1]), dotQuote(route.Stations[j]), attributes)
+		}
+	}
+
+	fmt.Fprintln(out, "}")
+	return out.Flush()
+}
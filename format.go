@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+)
+
+// fmt command: go run . fmt [-sort] [-w] <map>
+func runFormat(args []string) {
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	sorted := flags.Bool("sort", false, "sort the stations, connections and closures of every block by name")
+	write := flags.Bool("w", false, "write the result back to the map file instead of printing it")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		handleError("Usage: fmt [-sort] [-w] <map file>")
+	}
+	filePath := flags.Arg(0)
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		handleError(err.Error())
+	}
+	tree, err := parseSyntaxTree(file)
+	file.Close()
+	if err != nil {
+		handleError(err.Error())
+	}
+
+	if *sorted {
+		tree.sortEntries()
+	}
+
+	var formatted bytes.Buffer
+	if err := tree.format(&formatted); err != nil {
+		handleError(err.Error())
+	}
+
+	if !*write {
+		os.Stdout.Write(formatted.Bytes())
+		return
+	}
+	if err := os.WriteFile(filePath, formatted.Bytes(), 0644); err != nil {
+		handleError(err.Error())
+	}
+}
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Network families the generator can produce
+var generatorFamilies = []string{"grid", "ladder", "geometric", "scale-free", "bottleneck"}
+
+// Number of stations in each cluster of a bottleneck network
+const bottleneckClusterSize = 20
+
+// GeneratorOptions struct to store what kind of random network to generate
+// The same options and seed always produce the same network.
+type GeneratorOptions struct {
+	Family    string
+	Stations  int
+	Degree    int // average number of connections per station, the grid and ladder layouts fix their own
+	Connected bool
+	Seed      int64
+	Pairs     int // number of start/end pairs to pick
+}
+
+// generator struct to store the network being generated and the coordinates already taken
+type generator struct {
+	network *Network
+	rng     *rand.Rand
+	taken   map[[2]int]bool
+	side    int // random coordinates lie within [0, side)
+}
+
+// Generate a random network and start/end pairs that are connected in it
+func generateNetwork(options GeneratorOptions) (*Network, [][2]string, error) {
+	if options.Stations < 2 {
+		return nil, nil, errors.New("A generated network needs at least 2 stations")
+	}
+	if options.Degree < 1 {
+		return nil, nil, errors.New("The degree of a generated network must be at least 1")
+	}
+
+	g := &generator{
+		network: newNetwork(),
+		rng:     rand.New(rand.NewSource(options.Seed)),
+		taken:   make(map[[2]int]bool),
+		side:    10 * int(math.Ceil(math.Sqrt(float64(options.Stations)))),
+	}
+	var start, end string
+	switch options.Family {
+	case "grid":
+		start, end = g.grid(options.Stations)
+	case "ladder":
+		start, end = g.ladder(options.Stations)
+	case "geometric":
+		g.geometric(0, options.Stations, options.Degree, 0)
+	case "scale-free":
+		g.scaleFree(options.Stations, options.Degree)
+	case "bottleneck":
+		start, end = g.bottleneck(options.Stations, options.Degree)
+	default:
+		return nil, nil, errors.New("Unknown network family " + options.Family + ", expected one of " + strings.Join(generatorFamilies, ", "))
+	}
+	if options.Connected {
+		g.joinComponents()
+	}
+
+	// Go through the full map validation, so a generated network always loads
+	network, err := validatedNetwork(g.network, ParseLimits{})
+	if err != nil {
+		return nil, nil, err
+	}
+	return network, g.pairs(start, end, options.Pairs), nil
+}
+
+// Name of the i-th generated station
+func generatedName(i int) string {
+	return fmt.Sprintf("s%d", i)
+}
+
+// Add a station at the given coordinates
+func (g *generator) place(i, x, y int) {
+	g.taken[[2]int{x, y}] = true
+	addStation(g.network, &Station{Name: generatedName(i), X: float64(x), Y: float64(y)})
+}
+
+// Add a station at free random coordinates, offset horizontally by offsetX
+func (g *generator) placeRandom(i, offsetX int) {
+	for {
+		x, y := offsetX+g.rng.Intn(g.side), g.rng.Intn(g.side)
+		if !g.taken[[2]int{x, y}] {
+			g.place(i, x, y)
+			return
+		}
+	}
+}
+
+// Connect two stations unless they are the same or already connected, reports whether they were connected now
+func (g *generator) connect(station1, station2 string) bool {
+	if station1 == station2 || contains(g.network.Connections[station1], station2) {
+		return false
+	}
+	addConnection(g.network, station1, station2)
+	return true
+}
+
+// Number of connections giving the stations the average degree, as far as there are pairs of stations for them
+func targetConnections(stations, degree int) int {
+	target := stations * degree / 2
+	if pairs := stations * (stations - 1) / 2; target > pairs {
+		return pairs
+	}
+	return target
+}
+
+// Stations in rows and columns, each connected to its neighbours on the left, right, above and below
+func (g *generator) grid(stations int) (string, string) {
+	columns := int(math.Ceil(math.Sqrt(float64(stations))))
+	for i := 0; i < stations; i++ {
+		g.place(i, i%columns*10, i/columns*10)
+		if i%columns > 0 {
+			g.connect(generatedName(i-1), generatedName(i))
+		}
+		if i >= columns {
+			g.connect(generatedName(i-columns), generatedName(i))
+		}
+	}
+	return generatedName(0), generatedName(stations - 1)
+}
+
+// Two parallel rails joined by a rung at every station
+func (g *generator) ladder(stations int) (string, string) {
+	for i := 0; i < stations; i++ {
+		g.place(i, i/2*10, i%2*10)
+		if i >= 2 {
+			g.connect(generatedName(i-2), generatedName(i))
+		}
+		if i%2 == 1 {
+			g.connect(generatedName(i-1), generatedName(i))
+		}
+	}
+	return generatedName(0), generatedName(stations - 1)
+}
+
+// Stations at random coordinates, each connected to its nearest neighbours
+// The stations are numbered from first, offsetX shifts them horizontally. Every station is connected to its
+// nearest neighbour first, then to its second nearest and so on until the stations have the average degree.
+func (g *generator) geometric(first, stations, degree, offsetX int) {
+	// Stations sorted into square cells, so the nearest ones are found without measuring every pair
+	const cellSize = 10
+	cells := make(map[[2]int][]int)
+	x, y := make([]float64, stations), make([]float64, stations)
+	for i := first; i < first+stations; i++ {
+		g.placeRandom(i, offsetX)
+		station := g.network.Stations[generatedName(i)]
+		x[i-first], y[i-first] = station.X, station.Y
+		cell := [2]int{int(station.X) / cellSize, int(station.Y) / cellSize}
+		cells[cell] = append(cells[cell], i)
+	}
+
+	// Two stations may pick each other, so every station looks at as many neighbours as the degree,
+	// which is always enough to reach it
+	nearest := degree
+	if nearest > stations-1 {
+		nearest = stations - 1
+	}
+	neighbours := make([][]int, stations)
+	rings := (g.side+offsetX)/cellSize + 1
+	for i := first; i < first+stations; i++ {
+		station := g.network.Stations[generatedName(i)]
+		cx, cy := int(station.X)/cellSize, int(station.Y)/cellSize
+		distance := func(j int) float64 {
+			return math.Hypot(x[j-first]-station.X, y[j-first]-station.Y)
+		}
+
+		// Search rings of cells around the station until no closer station can be left outside them
+		var candidates []int
+		for ring := 0; ring <= rings; ring++ {
+			if len(candidates) >= nearest && float64((ring-1)*cellSize) > distance(candidates[nearest-1]) {
+				break
+			}
+			for column := cx - ring; column <= cx+ring; column++ {
+				for row := cy - ring; row <= cy+ring; row++ {
+					if column != cx-ring && column != cx+ring && row != cy-ring && row != cy+ring {
+						continue
+					}
+					for _, j := range cells[[2]int{column, row}] {
+						if j != i {
+							candidates = append(candidates, j)
+						}
+					}
+				}
+			}
+			sort.SliceStable(candidates, func(a, b int) bool {
+				return distance(candidates[a]) < distance(candidates[b])
+			})
+		}
+		if len(candidates) > nearest {
+			candidates = candidates[:nearest]
+		}
+		neighbours[i-first] = candidates
+	}
+
+	target, connected := targetConnections(stations, degree), 0
+	for rank := 0; rank < nearest && connected < target; rank++ {
+		for i := first; i < first+stations && connected < target; i++ {
+			if rank < len(neighbours[i-first]) && g.connect(generatedName(i), generatedName(neighbours[i-first][rank])) {
+				connected++
+			}
+		}
+	}
+}
+
+// Stations at random coordinates added one by one, each connecting to existing stations
+// with a chance proportional to their degree, which gives a few hubs and many small stations
+func (g *generator) scaleFree(stations, degree int) {
+	// Every connection end appears once, so a random pick favours busy stations
+	var ends []string
+	for i := 0; i < stations; i++ {
+		g.placeRandom(i, 0)
+		name := generatedName(i)
+		// Enough connections to keep the average degree of the stations so far, at least one
+		// and at most one to every earlier station
+		links := targetConnections(i+1, degree) - len(g.network.ConnectionOrder)
+		if links < 1 {
+			links = 1
+		}
+		if links >= i {
+			for j := 0; j < i; j++ {
+				g.connect(generatedName(j), name)
+				ends = append(ends, generatedName(j), name)
+			}
+			continue
+		}
+		for added := 0; added < links; {
+			target := ends[g.rng.Intn(len(ends))]
+			if target == name || contains(g.network.Connections[name], target) {
+				continue
+			}
+			g.connect(target, name)
+			ends = append(ends, target, name)
+			added++
+		}
+	}
+}
+
+// Clusters of stations side by side, each cluster joined to the next by a single connection
+func (g *generator) bottleneck(stations, degree int) (string, string) {
+	clusters := (stations + bottleneckClusterSize - 1) / bottleneckClusterSize
+	size := stations / clusters
+	g.side = 10 * int(math.Ceil(math.Sqrt(float64(size))))
+	first := 0
+	for cluster := 0; cluster < clusters; cluster++ {
+		if cluster == clusters-1 {
+			size = stations - first
+		}
+		g.geometric(first, size, degree, cluster*2*g.side)
+		if cluster > 0 {
+			// The easternmost station of the previous cluster meets the westernmost of this one
+			g.connect(g.extreme(first-stations/clusters, first, true), g.extreme(first, first+size, false))
+		}
+		first += size
+	}
+	// Trains between the outermost stations have to pass every bottleneck
+	return g.extreme(0, stations/clusters, false), g.extreme(stations-size, stations, true)
+}
+
+// Station with the largest (east) or smallest X coordinate among stations first to last-1
+func (g *generator) extreme(first, last int, east bool) string {
+	best := generatedName(first)
+	for i := first + 1; i < last; i++ {
+		x, bestX := g.network.Stations[generatedName(i)].X, g.network.Stations[best].X
+		if (east && x > bestX) || (!east && x < bestX) {
+			best = generatedName(i)
+		}
+	}
+	return best
+}
+
+// Connect every smaller component to the largest one by its closest pair of stations
+func (g *generator) joinComponents() {
+	components := connectedComponents(g.network)
+	for _, component := range components[1:] {
+		var closest [2]string
+		shortest := math.Inf(1)
+		for _, name1 := range components[0] {
+			for _, name2 := range component {
+				if distance := stationDistance(g.network, g.network.Stations[name1], g.network.Stations[name2]); distance < shortest {
+					closest, shortest = [2]string{name1, name2}, distance
+				}
+			}
+		}
+		g.connect(closest[0], closest[1])
+	}
+}
+
+// Pick start/end pairs that are connected, beginning with the given pair when there is one
+// and otherwise with two stations far apart in the largest component
+func (g *generator) pairs(start, end string, count int) [][2]string {
+	var pairs [][2]string
+	if count <= 0 {
+		return pairs
+	}
+	if start == "" || !pathExists(start, end, g.network, 0) {
+		components := connectedComponents(g.network)
+		start = farthestStation(g.network, components[0][0])
+		end = farthestStation(g.network, start)
+	}
+	pairs = append(pairs, [2]string{start, end})
+
+	components := connectedComponents(g.network)
+	if len(components[0]) < 2 {
+		return pairs
+	}
+	// Every pair is picked once, in either direction
+	picked := map[[2]string]bool{connectionKey(start, end): true}
+	for attempts := 0; len(pairs) < count && attempts < 100*count; attempts++ {
+		component := components[0]
+		pair := [2]string{component[g.rng.Intn(len(component))], component[g.rng.Intn(len(component))]}
+		if pair[0] != pair[1] && !picked[connectionKey(pair[0], pair[1])] {
+			picked[connectionKey(pair[0], pair[1])] = true
+			pairs = append(pairs, pair)
+		}
+	}
+	return pairs
+}
+
+// Station the most connections away from the given one, found with a breadth-first search
+func farthestStation(network *Network, start string) string {
+	distance := map[string]int{start: 0}
+	farthest := start
+	queue := []string{start}
+	for len(queue) > 0 {
+		station := queue[0]
+		queue = queue[1:]
+		if distance[station] > distance[farthest] {
+			farthest = station
+		}
+		for _, neighbor := range network.Connections[station] {
+			if _, seen := distance[neighbor]; !seen {
+				distance[neighbor] = distance[station] + 1
+				queue = append(queue, neighbor)
+			}
+		}
+	}
+	return farthest
+}
+
+// Write the start/end pairs, one "start end" pair per line
+func writePairs(pairs [][2]string, out io.Writer) {
+	for _, pair := range pairs {
+		fmt.Fprintf(out, "%s %s\n", pair[0], pair[1])
+	}
+}
+
+// generate command: go run . generate [-family f] [-stations n] [-degree d] [-connected] [-seed s] [-pairs n] [-o file]
+func runGenerate(args []string) {
+	flags := flag.NewFlagSet("generate", flag.ExitOnError)
+	var options GeneratorOptions
+	flags.StringVar(&options.Family, "family", "geometric", "kind of network: "+strings.Join(generatorFamilies, ", "))
+	flags.IntVar(&options.Stations, "stations", 100, "number of stations")
+	flags.IntVar(&options.Degree, "degree", 4, "average number of connections per station, the grid and ladder families have their own")
+	flags.BoolVar(&options.Connected, "connected", true, "join the parts of the network so every station can reach every other")
+	flags.Int64Var(&options.Seed, "seed", 1, "seed for the random source, the same seed always generates the same network")
+	flags.IntVar(&options.Pairs, "pairs", 1, "number of start/end pairs to pick")
+	outputFile := flags.String("o", "", "write the map to this file and the pairs to standard output, the format is chosen by its extension")
+	flags.Parse(args)
+	if flags.NArg() != 0 {
+		handleError("Usage: generate [-family family] [-stations n] [-degree d] [-connected=false] [-seed s] [-pairs n] [-o file]")
+	}
+
+	network, pairs, err := generateNetwork(options)
+	if err != nil {
+		handleError(err.Error())
+	}
+
+	// Without an output file the map takes standard output, so the pairs go to standard error
+	if *outputFile == "" {
+		if err := writeNetworkText(network, os.Stdout); err != nil {
+			handleError(err.Error())
+		}
+		writePairs(pairs, os.Stderr)
+		return
+	}
+	if err := writeNetworkFile(network, *outputFile); err != nil {
+		handleError(err.Error())
+	}
+	writePairs(pairs, os.Stdout)
+}
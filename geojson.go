@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// GeoJSON FeatureCollection holding stations as Point features and tracks as LineString features
+// Closures are kept in a "closures" member in the same form as in the JSON map format. Maps with
+// planar coordinates have a "coordinates" member set to "planar", as GeoJSON is longitude/latitude.
+type geoJSONCollection struct {
+	Type        string           `json:"type"`
+	Coordinates string           `json:"coordinates,omitempty"`
+	Features    []geoJSONFeature `json:"features"`
+	Closures    []jsonClosure    `json:"closures,omitempty"`
+}
+
+type geoJSONFeature struct {
+	Type       string                     `json:"type"`
+	Geometry   geoJSONGeometry            `json:"geometry"`
+	Properties map[string]json.RawMessage `json:"properties"`
+}
+
+type geoJSONGeometry struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+}
+
+// Parse a network from GeoJSON with longitude/latitude coordinates, or planar ones when the collection says so
+// Every Point needs a "name" property and becomes a station. A LineString connects, in order,
+// the stations lying exactly on its vertices; vertices between them only shape the track.
+// The "attributes" property holds the attributes of the stations and connections in order,
+// so an attribute may be called name too. Other properties, as found in GeoJSON from other
+// tools, become attributes as well, after those of the "attributes" property and ordered by key.
+func parseNetworkGeoJSON(reader io.Reader, limits ParseLimits) (*Network, error) {
+	decoder := json.NewDecoder(reader)
+	network := newNetwork()
+	network.Geographic = true
+	collectionType := ""
+	stationsAt := make(map[[2]float64]string)
+	// Tracks are connected once every station is known, as they may refer to stations defined after them
+	type track struct {
+		positions  [][]float64
+		attributes []Attribute
+	}
+	var tracks []track
+
+	// The features are read one at a time, stations are counted as they are read and tracks by
+	// the connection each of them makes at least
+	readFeature := func() error {
+		var feature geoJSONFeature
+		if err := decoder.Decode(&feature); err != nil {
+			return err
+		}
+		switch feature.Geometry.Type {
+		case "Point":
+			var position []float64
+			if err := json.Unmarshal(feature.Geometry.Coordinates, &position); err != nil || len(position) < 2 {
+				return errors.New("Invalid Point coordinates in GeoJSON map")
+			}
+			var name string
+			if err := json.Unmarshal(feature.Properties["name"], &name); err != nil || name == "" {
+				return fmt.Errorf("GeoJSON Point at %s,%s has no name property", formatCoordinate(position[0]), formatCoordinate(position[1]))
+			}
+			attributes, err := propertyAttributes(feature.Properties, "name")
+			if err != nil {
+				return err
+			}
+			addStation(network, &Station{Name: name, X: position[0], Y: position[1], Attributes: attributes})
+			stationsAt[[2]float64{position[0], position[1]}] = name
+			return checkLimit(len(network.StationOrder), limits.MaxStations, "stations")
+		case "LineString":
+			var positions [][]float64
+			if err := json.Unmarshal(feature.Geometry.Coordinates, &positions); err != nil {
+				return errors.New("Invalid LineString coordinates in GeoJSON map")
+			}
+			for _, position := range positions {
+				if len(position) < 2 {
+					return errors.New("Invalid LineString coordinates in GeoJSON map")
+				}
+			}
+			attributes, err := propertyAttributes(feature.Properties, "station1", "station2")
+			if err != nil {
+				return err
+			}
+			tracks = append(tracks, track{positions: positions, attributes: attributes})
+			return checkLimit(len(tracks), limits.MaxConnections, "connections")
+		}
+		return nil
+	}
+
+	err := readJSONObject(decoder, "GeoJSON map", func(key string) error {
+		switch key {
+		case "type":
+			return decoder.Decode(&collectionType)
+		case "coordinates":
+			var coordinates string
+			if err := decoder.Decode(&coordinates); err != nil {
+				return err
+			}
+			switch coordinates {
+			case "", "geographic":
+				network.Geographic = true
+			case "planar":
+				network.Geographic = false
+			default:
+				return errors.New("Invalid coordinates in GeoJSON map: " + coordinates)
+			}
+		case "features":
+			return readJSONArray(decoder, "Features in GeoJSON map", readFeature)
+		case "closures":
+			return readJSONArray(decoder, "Closures in GeoJSON map", func() error {
+				var closure jsonClosure
+				if err := decoder.Decode(&closure); err != nil {
+					return err
+				}
+				network.Closures = append(network.Closures, Closure{Station1: closure.Station1, Station2: closure.Station2, From: closure.From, To: closure.To})
+				return nil
+			})
+		default:
+			return skipJSONValue(decoder)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if collectionType != "FeatureCollection" {
+		return nil, errors.New("GeoJSON map is not a FeatureCollection")
+	}
+
+	for _, track := range tracks {
+		var stops []string
+		for _, position := range track.positions {
+			if name, exists := stationsAt[[2]float64{position[0], position[1]}]; exists {
+				stops = append(stops, name)
+			}
+		}
+		if len(stops) < 2 {
+			return nil, errors.New("GeoJSON LineString does not connect two stations")
+		}
+		for i := 1; i < len(stops); i++ {
+			network.ConnectionOrder = append(network.ConnectionOrder, [2]string{stops[i-1], stops[i]})
+			if len(track.attributes) > 0 {
+				network.ConnectionAttributes[connectionKey(stops[i-1], stops[i])] = track.attributes
+			}
+		}
+		if err := checkLimit(len(network.ConnectionOrder), limits.MaxConnections, "connections"); err != nil {
+			return nil, err
+		}
+	}
+
+	return validatedNetwork(network, limits)
+}
+
+// Turn GeoJSON properties into attributes, leaving out the properties naming the feature
+// The attributes of the "attributes" property come first, the other properties follow ordered by key.
+func propertyAttributes(properties map[string]json.RawMessage, identity ...string) ([]Attribute, error) {
+	var attributes jsonAttributes
+	if raw, exists := properties["attributes"]; exists {
+		if err := json.Unmarshal(raw, &attributes); err != nil {
+			return nil, errors.New("Invalid attributes property in GeoJSON map")
+		}
+	}
+	values := make(map[string]string)
+	for key, raw := range properties {
+		var value interface{}
+		if contains(identity, key) || key == "attributes" || json.Unmarshal(raw, &value) != nil || value == nil {
+			continue
+		}
+		values[key] = attributeText(value)
+	}
+	return append(attributes, sortedAttributes(values)...), nil
+}
+
+// GeoJSON properties of a feature: the properties naming it and its attributes kept apart under "attributes"
+func featureProperties(identity map[string]string, attributes []Attribute) map[string]json.RawMessage {
+	properties := make(map[string]json.RawMessage)
+	for key, value := range identity {
+		properties[key], _ = json.Marshal(value)
+	}
+	if len(attributes) > 0 {
+		properties["attributes"], _ = json.Marshal(jsonAttributes(attributes))
+	}
+	return properties
+}
+
+// Write the network as a GeoJSON FeatureCollection, stations as Points and connections as LineStrings
+func writeNetworkGeoJSON(network *Network, writer io.Writer) error {
+	collection := geoJSONCollection{Type: "FeatureCollection", Features: []geoJSONFeature{}}
+	if !network.Geographic {
+		collection.Coordinates = "planar"
+	}
+	position := func(name string) []float64 {
+		station := network.Stations[name]
+		return []float64{station.X, station.Y}
+	}
+	feature := func(geometryType string, coordinates interface{}, properties map[string]json.RawMessage) geoJSONFeature {
+		raw, _ := json.Marshal(coordinates)
+		return geoJSONFeature{Type: "Feature", Geometry: geoJSONGeometry{Type: geometryType, Coordinates: raw}, Properties: properties}
+	}
+
+	for _, name := range network.StationOrder {
+		properties := featureProperties(map[string]string{"name": name}, network.Stations[name].Attributes)
+		collection.Features = append(collection.Features, feature("Point", position(name), properties))
+	}
+	for _, connection := range network.ConnectionOrder {
+		coordinates := [][]float64{position(connection[0]), position(connection[1])}
+		identity := map[string]string{"station1": connection[0], "station2": connection[1]}
+		properties := featureProperties(identity, connectionAttributes(network, connection[0], connection[1]))
+		collection.Features = append(collection.Features, feature("LineString", coordinates, properties))
+	}
+	for _, closure := range network.Closures {
+		collection.Closures = append(collection.Closures, jsonClosure{Station1: closure.Station1, Station2: closure.Station2, From: closure.From, To: closure.To})
+	}
+
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(collection)
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Regex for an include directive: a path, quoted when it holds spaces, and an optional name prefix
+var includeRegex = regexp.MustCompile(`^include\s+(?:"([^"]+)"|(\S+))(?:\s+prefix=([a-zA-Z0-9_]+))?\s*(#.*)?$`)
+
+// A line of a map together with where it came from
+type sourceLine struct {
+	text   string
+	file   string // path of the file the line is in, as reached from the top map file
+	number int
+	prefix string // prefix added to the station names of the line
+	depth  int    // 0 for lines of the top map file, 1 and more for included files
+}
+
+// Where an included line came from, for error messages, empty for lines of the top map file
+func (line sourceLine) location() string {
+	if line.depth == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (in %s line %d)", line.file, line.number)
+}
+
+// An open map file on the include stack
+type includeFrame struct {
+	closer  io.Closer
+	scanner *bufio.Scanner
+	path    string
+	absPath string
+	number  int
+	prefix  string
+	section string // last section header read from this file
+}
+
+// Stream of map lines that follows include directives into other map files
+type mapLines struct {
+	frames        []*includeFrame
+	maxLineLength int
+}
+
+// Start reading a map, include paths are resolved relative to the directory of filePath
+// Lines longer than maxLineLength bytes are rejected, 0 allows lines of any length
+func newMapLines(reader io.Reader, filePath string, maxLineLength int) *mapLines {
+	absPath, _ := filepath.Abs(filePath)
+	lines := &mapLines{maxLineLength: maxLineLength}
+	lines.frames = []*includeFrame{{scanner: lines.newScanner(reader), path: filePath, absPath: absPath}}
+	return lines
+}
+
+// Scanner that never buffers much more than the longest allowed line
+func (lines *mapLines) newScanner(reader io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(reader)
+	if lines.maxLineLength > 0 {
+		// Room for the line ending, longer lines make the scanner stop with bufio.ErrTooLong
+		scanner.Buffer(make([]byte, 0, 4096), lines.maxLineLength+2)
+	} else {
+		scanner.Buffer(make([]byte, 0, 4096), math.MaxInt32)
+	}
+	return scanner
+}
+
+// Error for a line over the maximum length
+func (lines *mapLines) lineTooLong(frame *includeFrame, number int) error {
+	return fmt.Errorf("Line %d of %s is longer than %s bytes", number, frame.path, formatCount(lines.maxLineLength))
+}
+
+// Return the next non-blank, non-comment line, false once every file has been read
+func (lines *mapLines) next() (sourceLine, bool, error) {
+	for len(lines.frames) > 0 {
+		frame := lines.frames[len(lines.frames)-1]
+		depth := len(lines.frames) - 1
+
+		if !frame.scanner.Scan() {
+			err := frame.scanner.Err()
+			if err == bufio.ErrTooLong {
+				err = lines.lineTooLong(frame, frame.number+1)
+			}
+			if err != nil {
+				lines.closeAll()
+				return sourceLine{}, false, err
+			}
+			lines.close(frame)
+			lines.frames = lines.frames[:depth]
+			// Continue the including file in the section it was in before the include
+			if depth > 0 {
+				parent := lines.frames[depth-1]
+				if parent.section != "" {
+					return sourceLine{text: parent.section, file: parent.path, number: parent.number, prefix: parent.prefix, depth: depth - 1}, true, nil
+				}
+			}
+			continue
+		}
+
+		frame.number++
+		if lines.maxLineLength > 0 && len(strings.TrimRight(frame.scanner.Text(), "\r")) > lines.maxLineLength {
+			lines.closeAll()
+			return sourceLine{}, false, lines.lineTooLong(frame, frame.number)
+		}
+		text := strings.TrimSpace(frame.scanner.Text())
+		line := sourceLine{text: text, file: frame.path, number: frame.number, prefix: frame.prefix, depth: depth}
+
+		// Ignore blank lines and comments
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		if text == "stations:" || text == "connections:" || text == "closures:" {
+			frame.section = text
+		}
+
+		if strings.HasPrefix(text, "include ") || text == "include" {
+			if err := lines.include(line); err != nil {
+				lines.closeAll()
+				return sourceLine{}, false, err
+			}
+			continue
+		}
+
+		return line, true, nil
+	}
+	return sourceLine{}, false, nil
+}
+
+// Open an included map file and push it on the include stack
+func (lines *mapLines) include(line sourceLine) error {
+	match := includeRegex.FindStringSubmatch(line.text)
+	if match == nil {
+		return errors.New("Invalid include directive: " + line.text + line.location())
+	}
+	path := match[1]
+	if path == "" {
+		path = match[2]
+	}
+	parent := lines.frames[len(lines.frames)-1]
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(parent.path), path)
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	// An include cycle would never end
+	for i, frame := range lines.frames {
+		if frame.absPath == absPath {
+			chain := []string{}
+			for _, f := range lines.frames[i:] {
+				chain = append(chain, f.path)
+			}
+			chain = append(chain, path)
+			return errors.New("Include cycle: " + strings.Join(chain, " -> "))
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return errors.New("Cannot include " + path + ": " + err.Error() + line.location())
+	}
+	lines.frames = append(lines.frames, &includeFrame{
+		closer:  file,
+		scanner: lines.newScanner(file),
+		path:    path,
+		absPath: absPath,
+		prefix:  parent.prefix + match[3],
+	})
+	return nil
+}
+
+func (lines *mapLines) close(frame *includeFrame) {
+	if frame.closer != nil {
+		frame.closer.Close()
+	}
+}
+
+// Close every included file still open, used when reading stops early
+func (lines *mapLines) closeAll() {
+	for _, frame := range lines.frames {
+		lines.close(frame)
+	}
+	lines.frames = nil
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Network map in the JSON format
+//
+//	{
+//	  "coordinates": "planar",
+//	  "stations": [{"name": "waterloo", "x": 3, "y": 1, "attributes": {"zone": "1"}}, ...],
+//	  "connections": [{"station1": "waterloo", "station2": "victoria"}, ...],
+//	  "closures": [{"station1": "victoria", "from": 3, "to": 5}, ...]
+//	}
+//
+// Coordinates are "planar" (the default) or "geographic" for longitude/latitude in x/y.
+// A closure without station2 closes the whole station. Stations and connections keep their order
+// and may carry attributes, which keep their order as well.
+type jsonNetwork struct {
+	Coordinates string           `json:"coordinates,omitempty"`
+	Stations    []jsonStation    `json:"stations"`
+	Connections []jsonConnection `json:"connections"`
+	Closures    []jsonClosure    `json:"closures,omitempty"`
+}
+
+type jsonStation struct {
+	Name       string         `json:"name"`
+	X          float64        `json:"x"`
+	Y          float64        `json:"y"`
+	Attributes jsonAttributes `json:"attributes,omitempty"`
+}
+
+type jsonConnection struct {
+	Station1   string         `json:"station1"`
+	Station2   string         `json:"station2"`
+	Attributes jsonAttributes `json:"attributes,omitempty"`
+}
+
+type jsonClosure struct {
+	Station1 string `json:"station1"`
+	Station2 string `json:"station2,omitempty"`
+	From     int    `json:"from"`
+	To       int    `json:"to"`
+}
+
+// Attributes written as a JSON object whose keys are kept in the order of the attributes,
+// which a map would lose
+type jsonAttributes []Attribute
+
+// Write the attributes as a JSON object, in order
+func (attributes jsonAttributes) MarshalJSON() ([]byte, error) {
+	var buffer bytes.Buffer
+	buffer.WriteByte('{')
+	for i, attribute := range attributes {
+		if i > 0 {
+			buffer.WriteByte(',')
+		}
+		key, _ := json.Marshal(attribute.Key)
+		value, _ := json.Marshal(attribute.Value)
+		buffer.Write(key)
+		buffer.WriteByte(':')
+		buffer.Write(value)
+	}
+	buffer.WriteByte('}')
+	return buffer.Bytes(), nil
+}
+
+// Read the attributes from a JSON object key by key, keeping their order
+// Numbers and booleans are accepted as values and null values are left out.
+func (attributes *jsonAttributes) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return errors.New("Attributes in JSON map are not an object")
+	}
+	*attributes = nil
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		var value interface{}
+		if err := decoder.Decode(&value); err != nil {
+			return err
+		}
+		if value == nil {
+			continue
+		}
+		*attributes = append(*attributes, Attribute{Key: token.(string), Value: attributeText(value)})
+	}
+	_, err := decoder.Token()
+	return err
+}
+
+// Attribute value of a JSON value, numbers written like coordinates
+func attributeText(value interface{}) string {
+	switch value := value.(type) {
+	case string:
+		return value
+	case float64:
+		return formatCoordinate(value)
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// Parse a network map in the JSON format
+// The document is read member by member and element by element, so a map over one of the limits
+// is rejected as soon as its stations or connections cross it.
+func parseNetworkJSON(reader io.Reader, limits ParseLimits) (*Network, error) {
+	decoder := json.NewDecoder(reader)
+	network := newNetwork()
+	err := readJSONObject(decoder, "JSON map", func(key string) error {
+		switch key {
+		case "coordinates":
+			var coordinates string
+			if err := decoder.Decode(&coordinates); err != nil {
+				return err
+			}
+			switch coordinates {
+			case "", "planar":
+				network.Geographic = false
+			case "geographic":
+				network.Geographic = true
+			default:
+				return errors.New("Invalid coordinates in JSON map: " + coordinates)
+			}
+		case "stations":
+			return readJSONArray(decoder, "Stations in JSON map", func() error {
+				var station jsonStation
+				if err := decoder.Decode(&station); err != nil {
+					return err
+				}
+				addStation(network, &Station{Name: station.Name, X: station.X, Y: station.Y, Attributes: station.Attributes})
+				return checkLimit(len(network.StationOrder), limits.MaxStations, "stations")
+			})
+		case "connections":
+			return readJSONArray(decoder, "Connections in JSON map", func() error {
+				var connection jsonConnection
+				if err := decoder.Decode(&connection); err != nil {
+					return err
+				}
+				network.ConnectionOrder = append(network.ConnectionOrder, [2]string{connection.Station1, connection.Station2})
+				if len(connection.Attributes) > 0 {
+					network.ConnectionAttributes[connectionKey(connection.Station1, connection.Station2)] = connection.Attributes
+				}
+				return checkLimit(len(network.ConnectionOrder), limits.MaxConnections, "connections")
+			})
+		case "closures":
+			return readJSONArray(decoder, "Closures in JSON map", func() error {
+				var closure jsonClosure
+				if err := decoder.Decode(&closure); err != nil {
+					return err
+				}
+				network.Closures = append(network.Closures, Closure{Station1: closure.Station1, Station2: closure.Station2, From: closure.From, To: closure.To})
+				return nil
+			})
+		default:
+			return skipJSONValue(decoder)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return validatedNetwork(network, limits)
+}
+
+// Read a JSON object member by member, member is called with the decoder at the value of each member
+func readJSONObject(decoder *json.Decoder, what string, member func(key string) error) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token != json.Delim('{') {
+		return errors.New(what + " is not a JSON object")
+	}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		if err := member(token.(string)); err != nil {
+			return err
+		}
+	}
+	_, err = decoder.Token()
+	return err
+}
+
+// Read a JSON array element by element, element is called with the decoder at each element
+// A null array has no elements.
+func readJSONArray(decoder *json.Decoder, what string, element func() error) error {
+	token, err := decoder.Token()
+	if err != nil || token == nil {
+		return err
+	}
+	if token != json.Delim('[') {
+		return errors.New(what + " are not a JSON array")
+	}
+	for decoder.More() {
+		if err := element(); err != nil {
+			return err
+		}
+	}
+	_, err = decoder.Token()
+	return err
+}
+
+// Skip a JSON value token by token, without holding it in memory
+func skipJSONValue(decoder *json.Decoder) error {
+	depth := 0
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		switch token {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
+
+// Write the network in the JSON format
+func writeNetworkJSON(network *Network, writer io.Writer) error {
+	document := jsonNetwork{Stations: []jsonStation{}, Connections: []jsonConnection{}}
+	if network.Geographic {
+		document.Coordinates = "geographic"
+	}
+	for _, name := range network.StationOrder {
+		station := network.Stations[name]
+		document.Stations = append(document.Stations, jsonStation{Name: station.Name, X: station.X, Y: station.Y, Attributes: station.Attributes})
+	}
+	for _, connection := range network.ConnectionOrder {
+		attributes := connectionAttributes(network, connection[0], connection[1])
+		document.Connections = append(document.Connections, jsonConnection{Station1: connection[0], Station2: connection[1], Attributes: attributes})
+	}
+	for _, closure := range network.Closures {
+		document.Closures = append(document.Closures, jsonClosure{Station1: closure.Station1, Station2: closure.Station2, From: closure.From, To: closure.To})
+	}
+
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(document)
+}
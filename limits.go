@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// ParseLimits struct to store the limits a map has to stay within, 0 means no limit
+// Every limit is enforced as soon as the map crosses it, so an oversized map is rejected without
+// reading the rest of it.
+type ParseLimits struct {
+	MaxStations    int
+	MaxConnections int
+	MaxLineLength  int // in bytes, without the line ending
+}
+
+// Limits used by parseNetworkMap, the command line flags change them
+var defaultParseLimits = ParseLimits{
+	MaxStations:    10000,
+	MaxConnections: 0,
+	MaxLineLength:  64 * 1024,
+}
+
+// Write a count with thousands separators, e.g. 10,000
+func formatCount(count int) string {
+	digits := strconv.Itoa(count)
+	for i := len(digits) - 3; i > 0; i -= 3 {
+		digits = digits[:i] + "," + digits[i:]
+	}
+	return digits
+}
+
+// Error for a map that has crossed one of its limits
+func limitError(what string, limit int) error {
+	return fmt.Errorf("map contains more than %s %s", formatCount(limit), what)
+}
+
+// Check the number of stations or connections read so far against its limit
+func checkLimit(count, limit int, what string) error {
+	if limit > 0 && count > limit {
+		return limitError(what, limit)
+	}
+	return nil
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Severities of lint diagnostics
+const (
+	severityError   = "error"
+	severityWarning = "warning"
+	severityOff     = "off"
+)
+
+// Lint rules and their default severities
+var lintRules = map[string]string{
+	"parse":            severityError,   // the map cannot be loaded at all
+	"isolated-station": severityWarning, // station without connections
+	"dead-end":         severityWarning, // spur ending in a station with a single connection
+	"unreachable":      severityWarning, // station cut off from most of the network
+	"length-outlier":   severityWarning, // connection far longer than the others
+	"commented-out":    severityWarning, // block of station lines turned into comments
+}
+
+// Diagnostic struct to store a single lint finding
+type Diagnostic struct {
+	File     string `json:"file"`
+	Line     int    `json:"line,omitempty"`
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// Lint settings: the severity of every rule and the smallest commented-out block reported
+type lintOptions struct {
+	severities        map[string]string
+	minCommentedLines int
+}
+
+// Check a map file and return its diagnostics, ordered by line
+func lintMap(filePath string, options lintOptions) []Diagnostic {
+	var diagnostics []Diagnostic
+	report := func(line int, rule, message string) {
+		severity := options.severities[rule]
+		if severity == severityOff {
+			return
+		}
+		diagnostics = append(diagnostics, Diagnostic{File: filePath, Line: line, Rule: rule, Severity: severity, Message: message})
+	}
+
+	// Lines of the stations, connections and commented-out blocks come from the syntax tree of line-oriented maps
+	stationLines := make(map[string]int)
+	connectionLines := make(map[[2]string]int)
+	if file, err := os.Open(filePath); err == nil {
+		tree, err := parseSyntaxTree(file)
+		file.Close()
+		if err == nil {
+			for _, line := range tree.lines {
+				switch line.kind {
+				case stationLine:
+					stationLines[line.names[0]] = line.number
+				case connectionLine:
+					connectionLines[connectionKey(line.names[0], line.names[1])] = line.number
+				}
+			}
+			lintCommentedOut(tree, options.minCommentedLines, report)
+		}
+	}
+
+	network, err := parseNetworkMap(filePath)
+	if err != nil {
+		report(0, "parse", err.Error())
+		return diagnostics
+	}
+
+	// Isolated stations and dead-end spurs
+	for _, name := range network.StationOrder {
+		switch len(network.Connections[name]) {
+		case 0:
+			report(stationLines[name], "isolated-station", "station "+quoteName(name)+" has no connections")
+		case 1:
+			spur := deadEndSpur(network, name)
+			report(stationLines[name], "dead-end", fmt.Sprintf("station %s is a dead end (spur: %s)", quoteName(name), strings.Join(spur, " ")))
+		}
+	}
+
+	// Groups of stations cut off from most of the network, isolated stations are reported above
+	for _, component := range connectedComponents(network) {
+		if len(component) == 1 || 2*len(component) > len(network.Stations) {
+			continue
+		}
+		line := 0
+		for _, name := range component {
+			if stationLines[name] > 0 && (line == 0 || stationLines[name] < line) {
+				line = stationLines[name]
+			}
+		}
+		report(line, "unreachable", fmt.Sprintf("%d stations cannot reach the other %d stations: %s", len(component), len(network.Stations)-len(component), strings.Join(component, " ")))
+	}
+
+	// Connections whose length is far out compared with the rest of the map
+	if limit, ok := lengthOutlierLimit(network); ok {
+		for _, connection := range network.ConnectionOrder {
+			length := stationDistance(network, network.Stations[connection[0]], network.Stations[connection[1]])
+			if length > limit {
+				report(connectionLines[connectionKey(connection[0], connection[1])], "length-outlier", fmt.Sprintf("connection %s-%s is %.2f long, most connections are under %.2f", quoteName(connection[0]), quoteName(connection[1]), length, limit))
+			}
+		}
+	}
+
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		return diagnostics[i].Line < diagnostics[j].Line
+	})
+	return diagnostics
+}
+
+// Stations of the spur leading to a dead end, from the dead end up to the first junction
+func deadEndSpur(network *Network, deadEnd string) []string {
+	spur := []string{deadEnd}
+	previous, station := deadEnd, network.Connections[deadEnd][0]
+	for len(network.Connections[station]) == 2 {
+		spur = append(spur, station)
+		next := network.Connections[station][0]
+		if next == previous {
+			next = network.Connections[station][1]
+		}
+		previous, station = station, next
+		if station == deadEnd {
+			break
+		}
+	}
+	return spur
+}
+
+// Connection length above which a connection is an outlier: three interquartile ranges above the
+// upper quartile. Needs at least four connections to say anything.
+func lengthOutlierLimit(network *Network) (float64, bool) {
+	var lengths []float64
+	for _, connection := range network.ConnectionOrder {
+		lengths = append(lengths, stationDistance(network, network.Stations[connection[0]], network.Stations[connection[1]]))
+	}
+	if len(lengths) < 4 {
+		return 0, false
+	}
+	sort.Float64s(lengths)
+	lower, upper := lengths[len(lengths)/4], lengths[(3*len(lengths))/4]
+	return upper + 3*(upper-lower), true
+}
+
+// Report blocks of consecutive comments in the stations section that hold station lines
+func lintCommentedOut(tree *syntaxTree, minLines int, report func(line int, rule, message string)) {
+	start, count := 0, 0
+	flush := func() {
+		if count >= minLines && count > 0 {
+			message := fmt.Sprintf("%d commented-out station lines, remove or restore them", count)
+			if count == 1 {
+				message = "1 commented-out station line, remove or restore it"
+			}
+			report(start, "commented-out", message)
+		}
+		count = 0
+	}
+	section := ""
+	for _, line := range tree.lines {
+		if line.kind == sectionLine {
+			section = line.text
+		}
+		text := strings.TrimSpace(strings.TrimPrefix(line.text, "#"))
+		if line.kind == commentLine && section == "stations:" && syntaxStationRegex.MatchString(text) {
+			if count == 0 {
+				start = line.number
+			}
+			count++
+			continue
+		}
+		flush()
+	}
+	flush()
+}
+
+// Severity overrides given as repeated "rule=severity" flags
+type severityFlags map[string]string
+
+func (severities severityFlags) String() string {
+	var parts []string
+	for rule, severity := range severities {
+		parts = append(parts, rule+"="+severity)
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, " ")
+}
+
+func (severities severityFlags) Set(value string) error {
+	rule, severity, found := strings.Cut(value, "=")
+	if !found {
+		return fmt.Errorf("expected rule=severity, got %s", value)
+	}
+	if _, exists := lintRules[rule]; !exists {
+		return fmt.Errorf("unknown lint rule: %s", rule)
+	}
+	if severity != severityError && severity != severityWarning && severity != severityOff {
+		return fmt.Errorf("unknown severity %s, expected error, warning or off", severity)
+	}
+	severities[rule] = severity
+	return nil
+}
+
+// lint command: go run . lint [-severity rule=level ...] [-commented-lines n] [-json] <map> ...
+func runLint(args []string) {
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	severities := severityFlags{}
+	for rule, severity := range lintRules {
+		severities[rule] = severity
+	}
+	flags.Var(severities, "severity", "set the severity of a rule to error, warning or off, as rule=severity (repeatable)")
+	minCommentedLines := flags.Int("commented-lines", 3, "smallest block of commented-out station lines to report")
+	jsonOutput := flags.Bool("json", false, "print the diagnostics as JSON")
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		handleError("Usage: lint [-severity rule=severity ...] [-commented-lines n] [-json] <map file> ...")
+	}
+
+	options := lintOptions{severities: severities, minCommentedLines: *minCommentedLines}
+	diagnostics := []Diagnostic{}
+	for _, filePath := range flags.Args() {
+		diagnostics = append(diagnostics, lintMap(filePath, options)...)
+	}
+
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(diagnostics); err != nil {
+			handleError(err.Error())
+		}
+	} else {
+		for _, diagnostic := range diagnostics {
+			location := diagnostic.File
+			if diagnostic.Line > 0 {
+				location += fmt.Sprintf(":%d", diagnostic.Line)
+			}
+			fmt.Printf("%s: %s: %s (%s)\n", location, diagnostic.Severity, diagnostic.Message, diagnostic.Rule)
+		}
+	}
+
+	// Errors fail the command, so it can be used in CI
+	for _, diagnostic := range diagnostics {
+		if diagnostic.Severity == severityError {
+			os.Exit(1)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Concrete syntax tree of a map in the line-oriented format
+// Unlike parseNetworkMap it keeps everything that is written: comments, blank lines, the order of
+// lines and the text of values, so a map can be edited and written out again without losing anything.
+type syntaxTree struct {
+	lines []*syntaxLine
+}
+
+// Kinds of syntax lines
+const (
+	blankLine      = "blank"
+	commentLine    = "comment"
+	sectionLine    = "section"
+	directiveLine  = "directive" // coordinates: and include lines
+	stationLine    = "station"
+	connectionLine = "connection"
+	closureLine    = "closure"
+	unknownLine    = "unknown" // lines the format does not allow, kept as written
+)
+
+// A single line of a map
+type syntaxLine struct {
+	kind       string
+	number     int
+	text       string   // the trimmed line as written, used for blank, comment, section, directive and unknown lines
+	names      []string // station names: one for a station, two for a connection, one or two for a closure
+	values     []string // coordinates of a station or the turns of a closure, as written
+	attributes []Attribute
+	comment    string // inline comment including its '#', empty when there is none
+}
+
+// Regexes for the lines of the syntax tree, capturing inline comments
+var (
+	syntaxStationRegex    = regexp.MustCompile(`^` + namePattern + `\s*,\s*(-?[0-9]+(?:\.[0-9]+)?)\s*,\s*(-?[0-9]+(?:\.[0-9]+)?)` + attributesPattern + `\s*(#.*)?$`)
+	syntaxConnectionRegex = regexp.MustCompile(`^` + namePattern + `\s*-\s*` + namePattern + attributesPattern + `\s*(#.*)?$`)
+	syntaxClosureRegex    = regexp.MustCompile(`^` + namePattern + `\s*(?:-\s*` + namePattern + `\s*)?,\s*([0-9]+)\s*,\s*([0-9]+)\s*(#.*)?$`)
+)
+
+// Read a map into its syntax tree
+func parseSyntaxTree(reader io.Reader) (*syntaxTree, error) {
+	tree := &syntaxTree{}
+	section := ""
+	scanner := bufio.NewScanner(reader)
+	number := 0
+	for scanner.Scan() {
+		number++
+		text := strings.TrimSpace(scanner.Text())
+		line := &syntaxLine{kind: unknownLine, number: number, text: text}
+		tree.lines = append(tree.lines, line)
+
+		switch {
+		case text == "":
+			line.kind = blankLine
+		case strings.HasPrefix(text, "#"):
+			line.kind = commentLine
+		case text == "stations:" || text == "connections:" || text == "closures:":
+			line.kind = sectionLine
+			section = text
+		case strings.HasPrefix(text, "coordinates:") || strings.HasPrefix(text, "include "):
+			line.kind = directiveLine
+		case section == "stations:":
+			if match := syntaxStationRegex.FindStringSubmatch(text); match != nil {
+				attributes, err := parseAttributes(match[4])
+				if err == nil {
+					line.kind = stationLine
+					line.names = []string{unquoteName(match[1])}
+					line.values = []string{match[2], match[3]}
+					line.attributes = attributes
+					line.comment = match[5]
+				}
+			}
+		case section == "connections:":
+			if match := syntaxConnectionRegex.FindStringSubmatch(text); match != nil {
+				attributes, err := parseAttributes(match[3])
+				if err == nil {
+					line.kind = connectionLine
+					line.names = []string{unquoteName(match[1]), unquoteName(match[2])}
+					line.attributes = attributes
+					line.comment = match[4]
+				}
+			}
+		case section == "closures:":
+			if match := syntaxClosureRegex.FindStringSubmatch(text); match != nil {
+				line.kind = closureLine
+				line.names = []string{unquoteName(match[1])}
+				if match[2] != "" {
+					line.names = append(line.names, unquoteName(match[2]))
+				}
+				line.values = []string{match[3], match[4]}
+				line.comment = match[5]
+			}
+		}
+	}
+	return tree, scanner.Err()
+}
+
+// Sort every block of consecutive entries of the same kind by station names, leaving comments,
+// blank lines and everything else where they are
+func (tree *syntaxTree) sortEntries() {
+	for start := 0; start < len(tree.lines); {
+		kind := tree.lines[start].kind
+		end := start + 1
+		if kind == stationLine || kind == connectionLine || kind == closureLine {
+			for end < len(tree.lines) && tree.lines[end].kind == kind {
+				end++
+			}
+			block := tree.lines[start:end]
+			sort.SliceStable(block, func(i, j int) bool {
+				return strings.Join(block[i].names, "\x00") < strings.Join(block[j].names, "\x00")
+			})
+		}
+		start = end
+	}
+}
+
+// Write the tree in the canonical layout: one blank line before every section but the first, no
+// repeated or trailing blank lines, no spaces around separators, station coordinates aligned within
+// each section, and inline comments two spaces after their line
+func (tree *syntaxTree) format(writer io.Writer) error {
+	out := bufio.NewWriter(writer)
+
+	// Column widths of the station lines of each section
+	nameWidth := make(map[int]int)
+	xWidth := make(map[int]int)
+	sectionIndex := 0
+	for _, line := range tree.lines {
+		if line.kind == sectionLine {
+			sectionIndex++
+		}
+		if line.kind != stationLine {
+			continue
+		}
+		if width := len([]rune(quoteName(line.names[0]))); width > nameWidth[sectionIndex] {
+			nameWidth[sectionIndex] = width
+		}
+		if width := len(line.values[0]); width > xWidth[sectionIndex] {
+			xWidth[sectionIndex] = width
+		}
+	}
+
+	pendingBlank := false
+	written := false
+	sectionIndex = 0
+	for _, line := range tree.lines {
+		if line.kind == blankLine {
+			pendingBlank = written
+			continue
+		}
+		if line.kind == sectionLine {
+			sectionIndex++
+			pendingBlank = written
+		}
+		if pendingBlank {
+			fmt.Fprintln(out)
+			pendingBlank = false
+		}
+		written = true
+
+		var text string
+		switch line.kind {
+		case stationLine:
+			name := padRight(quoteName(line.names[0])+",", nameWidth[sectionIndex]+1)
+			text = fmt.Sprintf("%s %*s, %s", name, xWidth[sectionIndex], line.values[0], line.values[1])
+		case connectionLine:
+			text = quoteName(line.names[0]) + "-" + quoteName(line.names[1])
+		case closureLine:
+			text = quoteName(line.names[0])
+			if len(line.names) > 1 {
+				text += "-" + quoteName(line.names[1])
+			}
+			text += "," + line.values[0] + "," + line.values[1]
+		case directiveLine:
+			text = formatDirective(line.text)
+		default:
+			text = line.text
+		}
+		text += formatAttributes(line.attributes)
+		if line.comment != "" {
+			text += "  " + line.comment
+		}
+		fmt.Fprintln(out, text)
+	}
+
+	return out.Flush()
+}
+
+// Pad text with spaces to the given width in characters, names may hold multi-byte characters
+func padRight(text string, width int) string {
+	if padding := width - len([]rune(text)); padding > 0 {
+		return text + strings.Repeat(" ", padding)
+	}
+	return text
+}
+
+// Directive line with its whitespace tidied, the path of an include is written back as it was given
+// since a quoted path may hold spaces of its own
+func formatDirective(text string) string {
+	match := includeRegex.FindStringSubmatch(text)
+	if match == nil {
+		return strings.Join(strings.Fields(text), " ")
+	}
+	formatted := "include " + match[2]
+	if match[1] != "" {
+		formatted = `include "` + match[1] + `"`
+	}
+	if match[3] != "" {
+		formatted += " prefix=" + match[3]
+	}
+	if match[4] != "" {
+		formatted += " " + match[4]
+	}
+	return formatted
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// MergeOptions struct to store how two networks are combined
+// Names used in both networks are prefixed with Prefix1 and Prefix2, unless they are listed in Shared,
+// in which case both networks mean the same station and it appears once.
+type MergeOptions struct {
+	Prefix1     string
+	Prefix2     string
+	Shared      []string
+	Interchange [][2]string // new connections between the networks, using the merged names
+}
+
+// Combine two networks into one, returning every conflict found instead of stopping at the first one
+func mergeNetworks(network1, network2 *Network, options MergeOptions) (*Network, []string) {
+	var conflicts []string
+	merged := newNetwork()
+
+	if network1.Geographic != network2.Geographic {
+		conflicts = append(conflicts, "one network has geographic and the other planar coordinates")
+	}
+	merged.Geographic = network1.Geographic
+
+	for _, name := range options.Shared {
+		_, in1 := network1.Stations[name]
+		_, in2 := network2.Stations[name]
+		if !in1 || !in2 {
+			conflicts = append(conflicts, "shared station "+name+" is not in both networks")
+		}
+	}
+
+	// Merged name of every station of each network
+	rename := func(name string, prefix string, other *Network) string {
+		if _, clash := other.Stations[name]; !clash || contains(options.Shared, name) {
+			return name
+		}
+		return prefix + name
+	}
+	names1 := make(map[string]string)
+	names2 := make(map[string]string)
+	for _, name := range network1.StationOrder {
+		names1[name] = rename(name, options.Prefix1, network2)
+	}
+	for _, name := range network2.StationOrder {
+		names2[name] = rename(name, options.Prefix2, network1)
+	}
+
+	// Stations, checking names and coordinates across both networks
+	coordinates := make(map[string]string)
+	addStations := func(network *Network, names map[string]string) {
+		for _, name := range network.StationOrder {
+			station := network.Stations[name]
+			mergedName := names[name]
+			coordKey := formatCoordinate(station.X) + "," + formatCoordinate(station.Y)
+			if existing, exists := merged.Stations[mergedName]; exists {
+				if !contains(options.Shared, name) {
+					conflicts = append(conflicts, "station name "+mergedName+" is used by both networks, prefix it or declare it shared")
+				} else if existing.X != station.X || existing.Y != station.Y {
+					conflicts = append(conflicts, "shared station "+name+" has different coordinates in the two networks")
+				}
+				continue
+			}
+			if other, exists := coordinates[coordKey]; exists {
+				conflicts = append(conflicts, "stations '"+mergedName+"' and '"+other+"' share the same coordinates ("+coordKey+")")
+			}
+			coordinates[coordKey] = mergedName
+			addStation(merged, &Station{Name: mergedName, X: station.X, Y: station.Y, Attributes: station.Attributes})
+		}
+	}
+	addStations(network1, names1)
+	addStations(network2, names2)
+
+	// Connections of both networks, a connection between shared stations in both networks is kept once
+	addConnections := func(network *Network, names map[string]string) {
+		for _, connection := range network.ConnectionOrder {
+			station1, station2 := names[connection[0]], names[connection[1]]
+			if contains(merged.Connections[station1], station2) {
+				continue
+			}
+			addConnection(merged, station1, station2)
+			if attributes := connectionAttributes(network, connection[0], connection[1]); len(attributes) > 0 {
+				merged.ConnectionAttributes[connectionKey(station1, station2)] = attributes
+			}
+		}
+		for _, closure := range network.Closures {
+			closure.Station1 = names[closure.Station1]
+			if closure.Station2 != "" {
+				closure.Station2 = names[closure.Station2]
+			}
+			merged.Closures = append(merged.Closures, closure)
+		}
+	}
+	addConnections(network1, names1)
+	addConnections(network2, names2)
+
+	// Interchange connections between the two networks
+	for _, connection := range options.Interchange {
+		station1, station2 := connection[0], connection[1]
+		valid := true
+		for _, name := range connection {
+			if _, exists := merged.Stations[name]; !exists {
+				conflicts = append(conflicts, "interchange connection "+station1+"-"+station2+" names non-existing station "+name)
+				valid = false
+			}
+		}
+		if station1 == station2 {
+			conflicts = append(conflicts, "interchange connection between the same station: "+station1)
+			valid = false
+		}
+		if valid && contains(merged.Connections[station1], station2) {
+			conflicts = append(conflicts, "duplicate interchange connection between "+station1+" and "+station2)
+			valid = false
+		}
+		if valid {
+			addConnection(merged, station1, station2)
+		}
+	}
+
+	if len(conflicts) > 0 {
+		return nil, conflicts
+	}
+
+	// Run the full map validation over the result
+	validated, err := validatedNetwork(merged, defaultParseLimits)
+	if err != nil {
+		return nil, []string{err.Error()}
+	}
+	return validated, nil
+}
+
+// Read the connections of an interchange file: connection lines, optionally below a "connections:" header
+func parseInterchange(filePath string) ([][2]string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	connectionRegex := regexp.MustCompile(`^\s*` + namePattern + `\s*-\s*` + namePattern + `\s*(?:#.*)?$`)
+	var connections [][2]string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		// Ignore blank lines, comments and the section header
+		if line == "" || strings.HasPrefix(line, "#") || line == "connections:" {
+			continue
+		}
+
+		match := connectionRegex.FindStringSubmatch(line)
+		if match == nil {
+			return nil, fmt.Errorf("Invalid interchange connection format: %s", line)
+		}
+		connections = append(connections, [2]string{unquoteName(match[1]), unquoteName(match[2])})
+	}
+	return connections, scanner.Err()
+}
+
+// merge command: go run . merge [-prefix1 p] [-prefix2 p] [-shared a,b] [-interchange file] [-o file] <map1> <map2>
+func runMerge(args []string) {
+	flags := flag.NewFlagSet("merge", flag.ExitOnError)
+	var options MergeOptions
+	flags.StringVar(&options.Prefix1, "prefix1", "", "prefix for station names of the first map that clash with the second map")
+	flags.StringVar(&options.Prefix2, "prefix2", "", "prefix for station names of the second map that clash with the first map")
+	shared := flags.String("shared", "", "comma-separated station names that are the same station in both maps")
+	interchangeFile := flags.String("interchange", "", "file with the connections between the two maps")
+	outputFile := flags.String("o", "", "write the merged map to this file instead of printing it, the format is chosen by its extension")
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		handleError("Usage: merge [-prefix1 prefix] [-prefix2 prefix] [-shared names] [-interchange file] [-o file] <map file> <map file>")
+	}
+
+	network1, err := parseNetworkMap(flags.Arg(0))
+	if err != nil {
+		handleError(flags.Arg(0) + ": " + err.Error())
+	}
+	network2, err := parseNetworkMap(flags.Arg(1))
+	if err != nil {
+		handleError(flags.Arg(1) + ": " + err.Error())
+	}
+	if *shared != "" {
+		options.Shared = strings.Split(*shared, ",")
+	}
+	if *interchangeFile != "" {
+		if options.Interchange, err = parseInterchange(*interchangeFile); err != nil {
+			handleError(err.Error())
+		}
+	}
+	if (options.Prefix1 != "" || options.Prefix2 != "") && options.Prefix1 == options.Prefix2 {
+		handleError("The two maps need different prefixes")
+	}
+
+	merged, conflicts := mergeNetworks(network1, network2, options)
+	if len(conflicts) > 0 {
+		for _, conflict := range conflicts {
+			fmt.Fprintln(os.Stderr, "Conflict:", conflict)
+		}
+		if len(conflicts) == 1 {
+			handleError("1 conflict, the maps were not merged")
+		}
+		handleError(fmt.Sprintf("%d conflicts, the maps were not merged", len(conflicts)))
+	}
+
+	if *outputFile == "" {
+		if err := writeNetworkText(merged, os.Stdout); err != nil {
+			handleError(err.Error())
+		}
+		return
+	}
+	if err := writeNetworkFile(merged, *outputFile); err != nil {
+		handleError(err.Error())
+	}
+}
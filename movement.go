@@ -2,24 +2,86 @@ package main
 
 import (
 	"fmt"
+	"io"
+	"sort"
 	"strings"
 )
 
-func simulateTrains(network *Network, startStation, endStation string, numTrains int) {
-	// Create a slice to hold the trains
+// Upper limit of turns for a single simulation, guards against runs that never settle
+const maxSimulationTurns = 10000
+
+// Create the given number of trains waiting at the start station, all ready to leave on turn 1
+func newTrains(numTrains int, startStation string) []*Train {
 	trains := make([]*Train, numTrains)
+	for i := 0; i < numTrains; i++ {
+		trains[i] = &Train{Name: fmt.Sprintf("T%d", i+1), Current: startStation, Departure: 1, Legs: 1}
+	}
+	return trains
+}
+
+// Turn the trains into shuttles that run the given number of return trips between the terminals
+func setReturnTrips(trains []*Train, trips int) {
+	for _, train := range trains {
+		train.Legs = 2 * trips
+	}
+}
+
+// Station the train is heading to on its current leg: odd legs head back to the start station
+func legDestination(train *Train, startStation, endStation string) string {
+	if train.Leg%2 == 1 {
+		return startStation
+	}
+	return endStation
+}
+
+// Check if the train has completed all of its legs
+func trainFinished(train *Train) bool {
+	return train.Leg >= train.Legs
+}
+
+// Order in which trains get to move on a turn: trains with the earliest deadline go first,
+// trains without a deadline keep their original order after them
+func movementOrder(trains []*Train) []int {
+	order := make([]int, len(trains))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		deadlineA, deadlineB := trains[order[a]].Deadline, trains[order[b]].Deadline
+		if deadlineA == 0 || deadlineB == 0 {
+			return deadlineA != 0 && deadlineB == 0
+		}
+		return deadlineA < deadlineB
+	})
+	return order
+}
+
+// Move the trains from the start station to the end station turn by turn, writing the movements to out
+// Random disruptions are injected when a disruption model is given
+func simulateTrains(network *Network, startStation, endStation string, trains []*Train, disruptions *DisruptionModel, out io.Writer) SimulationResult {
+	// Disruptions add closures, keep them away from the caller's network
+	if disruptions != nil {
+		runNetwork := *network
+		runNetwork.Closures = append([]Closure(nil), network.Closures...)
+		network = &runNetwork
+	}
+
+	numTrains := len(trains)
 	// Create a slice to track delays for each train
 	trainDelays := make([]int, numTrains)
 	// Create a map to track visited history for each train
 	visitedHistories := make([]map[string]bool, numTrains)
 
-	// Initialize all trains at the start station
+	// Initialize the visited history and route of all trains with the start station
 	for i := 0; i < numTrains; i++ {
-		trains[i] = &Train{Name: fmt.Sprintf("T%d", i+1), Current: startStation}
 		visitedHistories[i] = make(map[string]bool) // Properly initialize the map
 		visitedHistories[i][startStation] = true
+		trains[i].Route = []string{startStation}
 	}
 
+	// Trains with tighter deadlines get the first pick of stations and segments
+	order := movementOrder(trains)
+
 	// Initialize turn counter and consecutive stuck turns counter
 	turn := 1
 	consecutiveStuckTurns := 0
@@ -27,7 +89,7 @@ func simulateTrains(network *Network, startStation, endStation string, numTrains
 	// Main simulation loop
 	for {
 		// Maps to track used segments and occupied stations
-		usedSegments := make(map[string]bool)
+		usedSegments := make(map[[2]string]bool)
 		occupiedStations := make(map[string]bool)
 
 		// Mark stations occupied by trains (except the end station)
@@ -41,23 +103,63 @@ func simulateTrains(network *Network, startStation, endStation string, numTrains
 		delete(occupiedStations, startStation)
 		delete(occupiedStations, endStation)
 
-		// Slice to track movements in the current turn
-		movement := []string{}
+		// Slice to track movements in the current turn, indexed by train
+		moves := make([]string, numTrains)
 		// Flag to check if all trains have reached their destinations
 		allTrainsAtDestination := true
 
-		fmt.Printf("Turn %d:\n", turn)
+		fmt.Fprintf(out, "Turn %d:\n", turn)
+
+		// Inject the random disruptions of this turn
+		if disruptions != nil {
+			applyDisruptions(disruptions, network, trains, startStation, endStation, turn, out)
+		}
+
+		// Flag to check if some trains are still waiting for their departure turn or a hold to end
+		trainsWaiting := false
 
 		// Iterate over each train to determine its movement
-		for i, train := range trains {
-			// Skip trains that have already reached the end station
-			if train.Current == endStation {
+		for _, i := range order {
+			train := trains[i]
+			// Skip trains that have already completed all of their legs
+			if trainFinished(train) {
+				continue
+			}
+			destination := legDestination(train, startStation, endStation)
+			// Head for the next via station first
+			if train.ViaIndex < len(train.Via) {
+				destination = train.Via[train.ViaIndex]
+			}
+
+			// Never start a train before its departure turn
+			if train.Current == startStation && turn < train.Departure {
+				trainsWaiting = true
 				continue
 			}
 
+			// Held trains stay where they are
+			if turn <= train.HeldUntil {
+				trainsWaiting = true
+				continue
+			}
+
+			// Replan trains whose assigned route runs into a closure
+			if len(train.AssignedPath) > 1 && routeClosed(network, train.AssignedPath, turn) {
+				train.AssignedPath = nil
+				train.Detour = true
+				// Allow the new route to double back around the closure
+				visitedHistories[i] = map[string]bool{train.Current: true}
+			} else if train.Detour && closureLifted(network, turn) {
+				// Trains on a detour look for a shorter route once a closure has ended, and stay on
+				// a detour while other closures are still to come
+				train.AssignedPath = nil
+				train.Detour = lastClosureTurn(network) >= turn
+				visitedHistories[i] = map[string]bool{train.Current: true}
+			}
+
 			// Assign path if not already assigned and the train is not at the start station
 			if train.AssignedPath == nil || len(train.AssignedPath) == 0 && train.Current != startStation {
-				train.AssignedPath = dynamicDFS(train.Name, train.Current, endStation, network, occupiedStations, usedSegments, trains, visitedHistories[i])
+				train.AssignedPath = dynamicDFS(train.Name, train.Current, destination, network, occupiedStations, usedSegments, trains, visitedHistories[i], turn)
 				if train.AssignedPath == nil {
 					allTrainsAtDestination = false
 					continue
@@ -67,13 +169,13 @@ func simulateTrains(network *Network, startStation, endStation string, numTrains
 			// Determine the next station and segment for the train
 			if len(train.AssignedPath) > 1 {
 				nextStation := train.AssignedPath[1]
-				segment := fmt.Sprintf("%s-%s", train.Current, nextStation)
+				segment := [2]string{train.Current, nextStation}
 
-				// Ensure the next station and the segment are available
-				if !occupiedStations[nextStation] && !usedSegments[segment] {
+				// Ensure the next station and the segment are available and not closed
+				if !occupiedStations[nextStation] && !usedSegments[segment] && !moveClosed(network, train.Current, nextStation, turn) {
 					previousStation := train.Current
 					train.Current = nextStation
-					movement = append(movement, fmt.Sprintf("%s-%s", train.Name, nextStation))
+					moves[i] = fmt.Sprintf("%s-%s", train.Name, quoteName(nextStation))
 
 					// Update occupancy
 					if previousStation != endStation {
@@ -82,57 +184,166 @@ func simulateTrains(network *Network, startStation, endStation string, numTrains
 					if nextStation != endStation {
 						occupiedStations[nextStation] = true
 					}
+					// Mark the track used in both directions, trains cannot pass each other on it
 					usedSegments[segment] = true
+					usedSegments[[2]string{nextStation, previousStation}] = true
 
-					// Update visited history
+					train.Blocked = 0
+
+					// Update visited history and route
 					visitedHistories[i][nextStation] = true
+					train.Route = append(train.Route, nextStation)
 
 					// Remove the first station from the assigned path
 					train.AssignedPath = train.AssignedPath[1:]
 
+					// Head on from a via station once it has been passed
+					if train.ViaIndex < len(train.Via) && nextStation == train.Via[train.ViaIndex] {
+						train.ViaIndex++
+						train.AssignedPath = nil
+						visitedHistories[i] = map[string]bool{nextStation: true}
+					} else if nextStation == destination {
+						// Record the leg arrival and turn the train around for its next leg
+						train.LegArrivals = append(train.LegArrivals, turn)
+						train.Leg++
+						// Every outbound leg passes the via stations again
+						if train.Leg%2 == 0 {
+							train.ViaIndex = 0
+						}
+						train.AssignedPath = nil
+						visitedHistories[i] = map[string]bool{nextStation: true}
+						if trainFinished(train) {
+							train.Arrival = turn
+						}
+					}
+
 					// Update delay for subsequent trains
 					for j := i + 1; j < numTrains; j++ {
 						trainDelays[j]++
 					}
 				} else {
 					allTrainsAtDestination = false
+					// A train kept waiting for more than a turn by a closure or a held train, or waiting on
+					// a detour, looks for another way. Other trains wait, as they would without disruptions.
+					if train.Detour || moveClosed(network, train.Current, nextStation, turn) || trainHeldAt(trains, nextStation, turn) {
+						train.Blocked++
+					}
+					if train.Blocked > 1 {
+						train.AssignedPath = nil
+						train.Blocked = 0
+						visitedHistories[i] = map[string]bool{train.Current: true}
+					}
 				}
 			} else {
 				allTrainsAtDestination = false
 			}
 		}
 
+		// Collect the movements in train order
+		movement := []string{}
+		for _, move := range moves {
+			if move != "" {
+				movement = append(movement, move)
+			}
+		}
+
 		// If no movements occurred, increment the consecutive stuck turns counter
-		if len(movement) == 0 {
+		// Waiting for a departure turn, a hold or a closure to end does not count as being stuck
+		if len(movement) == 0 && !trainsWaiting && !trainsWaitingForClosures(network, trains, startStation, endStation, turn) {
 			consecutiveStuckTurns++
 		} else {
 			consecutiveStuckTurns = 0
 		}
 
-		fmt.Printf("%s\n", strings.Join(movement, " "))
+		fmt.Fprintf(out, "%s\n", strings.Join(movement, " "))
 
 		// Check if all trains have reached their destinations
-		allTrainsAtDestination = true
-		for _, train := range trains {
-			if train.Current != endStation {
-				allTrainsAtDestination = false
-				break
-			}
-		}
+		allTrainsAtDestination = allTrainsArrived(trains)
 
 		// If all trains have reached their destinations, end the simulation
 		if allTrainsAtDestination {
-			fmt.Println("All trains have reached their destinations. Simulation ending.")
+			fmt.Fprintln(out, "All trains have reached their destinations. Simulation ending.")
 			break
 		}
 
 		// If no trains moved for 2 consecutive turns, end the simulation
 		if consecutiveStuckTurns >= 2 {
-			fmt.Println("Faulty simulation detected: No trains moved for 2 consecutive turns. Exiting simulation.")
+			fmt.Fprintln(out, "Faulty simulation detected: No trains moved for 2 consecutive turns. Exiting simulation.")
+			break
+		}
+
+		// Never let a simulation run forever
+		if turn >= maxSimulationTurns {
+			fmt.Fprintf(out, "Simulation exceeded %d turns. Exiting simulation.\n", maxSimulationTurns)
 			break
 		}
 
 		// Increment the turn counter
 		turn++
 	}
+
+	printLegReport(trains, startStation, endStation, out)
+	printDeadlineReport(trains, out)
+
+	return SimulationResult{Turns: turn, Completed: allTrainsArrived(trains)}
+}
+
+// Check if some unfinished train has no route to where it is heading that avoids the closures, now or later,
+// but will have one once the closures are over. Trains that do have an open route and still do not move are stuck.
+func trainsWaitingForClosures(network *Network, trains []*Train, startStation, endStation string, turn int) bool {
+	for _, train := range trains {
+		if trainFinished(train) {
+			continue
+		}
+		destination := legDestination(train, startStation, endStation)
+		if train.ViaIndex < len(train.Via) {
+			destination = train.Via[train.ViaIndex]
+		}
+		if !openPathExists(train.Current, destination, network, turn) && pathExists(train.Current, destination, network, lastClosureTurn(network)+1) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check if a train held by a disruption is standing at the station on the given turn
+func trainHeldAt(trains []*Train, station string, turn int) bool {
+	for _, train := range trains {
+		if train.Current == station && turn <= train.HeldUntil {
+			return true
+		}
+	}
+	return false
+}
+
+// Check if every train has completed all of its legs
+func allTrainsArrived(trains []*Train) bool {
+	for _, train := range trains {
+		if !trainFinished(train) {
+			return false
+		}
+	}
+	return true
+}
+
+// Print the turn each train arrived at the end of every leg, only for shuttle runs
+func printLegReport(trains []*Train, startStation, endStation string, out io.Writer) {
+	if len(trains) == 0 || trains[0].Legs <= 1 {
+		return
+	}
+	fmt.Fprintln(out, "Leg arrivals:")
+	for _, train := range trains {
+		arrivals := []string{}
+		for leg, arrival := range train.LegArrivals {
+			destination := endStation
+			if leg%2 == 1 {
+				destination = startStation
+			}
+			arrivals = append(arrivals, fmt.Sprintf("leg %d %s turn %d", leg+1, destination, arrival))
+		}
+		if len(arrivals) == 0 {
+			arrivals = append(arrivals, "no legs completed")
+		}
+		fmt.Fprintf(out, "  %s: %s\n", train.Name, strings.Join(arrivals, ", "))
+	}
 }
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Station names are either plain ([a-zA-Z0-9_]) or quoted, quoted names may hold any character but '"'
+const namePattern = `("[^"]+"|[a-zA-Z0-9_]+)`
+
+var (
+	nameRegex      = regexp.MustCompile(namePattern)
+	plainNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+)
+
+// Station name from a name token of a map line, removing the quotes of a quoted name
+func unquoteName(token string) string {
+	if len(token) >= 2 && strings.HasPrefix(token, `"`) && strings.HasSuffix(token, `"`) {
+		return token[1 : len(token)-1]
+	}
+	return token
+}
+
+// Station name as it is written in maps and movement output, quoted unless it is a plain name
+func quoteName(name string) string {
+	if plainNameRegex.MatchString(name) {
+		return name
+	}
+	return `"` + name + `"`
+}
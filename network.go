@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Create an empty network
+func newNetwork() *Network {
+	return &Network{
+		Stations:    make(map[string]*Station),
+		Connections: make(map[string][]string),
+		Paths:       make(map[string]map[string][]string),
+
+		ConnectionAttributes: make(map[[2]string][]Attribute),
+	}
+}
+
+// Add a station to the network, keeping the definition order
+func addStation(network *Network, station *Station) {
+	network.Stations[station.Name] = station
+	network.StationOrder = append(network.StationOrder, station.Name)
+}
+
+// Add a connection between two stations to the network, keeping the definition order
+func addConnection(network *Network, station1, station2 string) {
+	network.Connections[station1] = append(network.Connections[station1], station2)
+	network.Connections[station2] = append(network.Connections[station2], station1)
+	network.ConnectionOrder = append(network.ConnectionOrder, [2]string{station1, station2})
+}
+
+// Check a network built from another format by writing it in the line-oriented format and
+// parsing it from there, so every format goes through exactly the same validation
+func validatedNetwork(network *Network, limits ParseLimits) (*Network, error) {
+	var text strings.Builder
+	if err := writeNetworkText(network, &text); err != nil {
+		return nil, err
+	}
+	return parseNetworkText(strings.NewReader(text.String()), "", limits)
+}
+
+// Write the network in the line-oriented stations:/connections: format
+func writeNetworkText(network *Network, writer io.Writer) error {
+	out := bufio.NewWriter(writer)
+
+	if network.Geographic {
+		fmt.Fprintln(out, "coordinates: geographic")
+	}
+	fmt.Fprintln(out, "stations:")
+	for _, name := range network.StationOrder {
+		station := network.Stations[name]
+		fmt.Fprintf(out, "%s,%s,%s%s\n", quoteName(station.Name), formatCoordinate(station.X), formatCoordinate(station.Y), formatAttributes(station.Attributes))
+	}
+
+	fmt.Fprintln(out, "\nconnections:")
+	for _, connection := range network.ConnectionOrder {
+		fmt.Fprintf(out, "%s-%s%s\n", quoteName(connection[0]), quoteName(connection[1]), formatAttributes(connectionAttributes(network, connection[0], connection[1])))
+	}
+
+	if len(network.Closures) > 0 {
+		fmt.Fprintln(out, "\nclosures:")
+		for _, closure := range network.Closures {
+			fmt.Fprintln(out, closureText(closure))
+		}
+	}
+
+	return out.Flush()
+}
+
+// Closure in the map format, e.g. "victoria,3,5" or "waterloo-euston,1,2"
+func closureText(closure Closure) string {
+	target := quoteName(closure.Station1)
+	if closure.Station2 != "" {
+		target += "-" + quoteName(closure.Station2)
+	}
+	return fmt.Sprintf("%s,%d,%d", target, closure.From, closure.To)
+}
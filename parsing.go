@@ -2,36 +2,88 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"errors"
-	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
 )
 
-// Read and parse the network map file
+// Read and parse the network map file within the default limits
 func parseNetworkMap(filePath string) (*Network, error) {
+	return parseNetworkMapWithLimits(filePath, defaultParseLimits)
+}
+
+// Read and parse the network map file, other formats are detected by their extension or content
+func parseNetworkMapWithLimits(filePath string, limits ParseLimits) (*Network, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
 		return nil, err
 	}
 	defer file.Close()
 
-	network := &Network{
-		Stations:    make(map[string]*Station),
-		Connections: make(map[string][]string),
-		Paths:       make(map[string]map[string][]string),
+	reader := bufio.NewReader(file)
+	switch mapFormat(filePath, reader) {
+	case "json":
+		return parseNetworkJSON(reader, limits)
+	case "dot":
+		return parseNetworkDOT(reader, limits)
+	case "geojson":
+		return parseNetworkGeoJSON(reader, limits)
+	}
+	return parseNetworkText(reader, filePath, limits)
+}
+
+// Detect the format of a map from its extension, or from its content when the extension is not known:
+// "geojson" for a FeatureCollection, "json" for other content starting with "{", "dot" for content
+// starting with a graph header, "text" otherwise
+func mapFormat(filePath string, reader *bufio.Reader) string {
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".json":
+		return "json"
+	case ".geojson":
+		return "geojson"
+	case ".dot", ".gv":
+		return "dot"
+	case ".map":
+		return "text"
 	}
+	start, _ := reader.Peek(512)
+	start = bytes.TrimSpace(start)
+	if bytes.HasPrefix(start, []byte("{")) {
+		if bytes.Contains(start, []byte(`"FeatureCollection"`)) {
+			return "geojson"
+		}
+		return "json"
+	}
+	for _, header := range []string{"graph", "digraph", "strict"} {
+		if bytes.HasPrefix(start, []byte(header)) {
+			return "dot"
+		}
+	}
+	return "text"
+}
 
-	scanner := bufio.NewScanner(file)
+// Parse a network map in the line-oriented stations:/connections: format
+// The map is read line by line and parsing stops as soon as one of the limits is crossed.
+// Include directives are resolved relative to the directory of filePath.
+func parseNetworkText(reader io.Reader, filePath string, limits ParseLimits) (*Network, error) {
+	network := newNetwork()
+
+	lines := newMapLines(reader, filePath, limits.MaxLineLength)
+	defer lines.closeAll()
 	stationSection := false
 	stationSectionEncountered := false
 	connectionSection := false
 	connectionSectionEncountered := false
+	closureSection := false
 	coordinates := make(map[string]string)
 
 	//flags
+	coordinatesdirectiveflag := false
 	stationformatflag := false
 	xcoordinateflag := false
 	ycoordinateflag := false
@@ -42,10 +94,13 @@ func parseNetworkMap(filePath string) (*Network, error) {
 	nonexistingstation1flag := false
 	nonexistingstation2flag := false
 	duplicateconnectionflag := false
+	closureflag := false
+	attributeflag := false
 
 	//variables for error handling
 	// kirjutada muutujad suurte tähtedega
 	var (
+		coordinatesdirectiveline      string
 		stationformatline             string
 		xcoordinatename               string
 		ycoordinatename               string
@@ -59,23 +114,41 @@ func parseNetworkMap(filePath string) (*Network, error) {
 		nonexistingstation2           string
 		duplicatestation1             string
 		duplicatestation2             string
+		closureerror                  error
+		attributeerror                string
 	)
 
 	// Regex to allow flexible whitespace and comments
-	stationRegex := regexp.MustCompile(`^\s*([a-zA-Z0-9_]+)\s*,\s*([0-9]+)\s*,\s*([0-9]+)\s*(?:#.*)?$`)
-	connectionRegex := regexp.MustCompile(`^\s*([a-zA-Z0-9_]+)\s*-\s*([a-zA-Z0-9_]+)\s*(?:#.*)?$`)
+	// Both may be followed by key=value attributes
+	stationRegex := regexp.MustCompile(`^\s*` + namePattern + `\s*,\s*(-?[0-9]+(?:\.[0-9]+)?)\s*,\s*(-?[0-9]+(?:\.[0-9]+)?)` + attributesPattern + `\s*(?:#.*)?$`)
+	connectionRegex := regexp.MustCompile(`^\s*` + namePattern + `\s*-\s*` + namePattern + attributesPattern + `\s*(?:#.*)?$`)
 
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
+	for {
+		source, ok, err := lines.next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		line := source.text
 
-		// Ignore blank lines and comments
-		if line == "" || strings.HasPrefix(line, "#") {
+		// The coordinate system has to be set before any station is read
+		if strings.HasPrefix(line, "coordinates:") {
+			value := strings.TrimSpace(strings.TrimPrefix(line, "coordinates:"))
+			if (value != "geographic" && value != "planar") || stationSectionEncountered {
+				coordinatesdirectiveflag = true
+				coordinatesdirectiveline = line + source.location()
+				continue
+			}
+			network.Geographic = value == "geographic"
 			continue
 		}
 
 		if line == "stations:" {
 			stationSection = true
 			connectionSection = false
+			closureSection = false
 			stationSectionEncountered = true
 			continue
 		}
@@ -83,71 +156,113 @@ func parseNetworkMap(filePath string) (*Network, error) {
 		if line == "connections:" {
 			connectionSection = true
 			stationSection = false
+			closureSection = false
 			connectionSectionEncountered = true
 			continue
 		}
 
+		if line == "closures:" {
+			closureSection = true
+			stationSection = false
+			connectionSection = false
+			continue
+		}
+
 		if stationSection {
 			match := stationRegex.FindStringSubmatch(line)
 			if match == nil {
 				stationformatflag = true
-				stationformatline = line
+				stationformatline = line + source.location()
 				continue
 			}
-			name, xStr, yStr := match[1], match[2], match[3]
-			x, err := strconv.Atoi(xStr)
-			if err != nil || x < 0 {
+			name, xStr, yStr := source.prefix+unquoteName(match[1]), match[2], match[3]
+			x, err := strconv.ParseFloat(xStr, 64)
+			if err != nil || !validCoordinate(network, x, 180) {
 				xcoordinateflag = true
-				xcoordinatename = name
+				xcoordinatename = name + source.location()
 			}
-			y, err := strconv.Atoi(yStr)
-			if err != nil || y < 0 {
+			y, err := strconv.ParseFloat(yStr, 64)
+			if err != nil || !validCoordinate(network, y, 90) {
 				ycoordinateflag = true
-				ycoordinatename = name
+				ycoordinatename = name + source.location()
 			}
 			if _, exists := network.Stations[name]; exists {
 				duplicatestationflag = true
-				duplicatestationname = name
+				duplicatestationname = name + source.location()
 			}
-			coordKey := fmt.Sprintf("%d,%d", x, y)
+			coordKey := formatCoordinate(x) + "," + formatCoordinate(y)
 			if existingStation, exists := coordinates[coordKey]; exists {
 				samecoordinatesflag = true
 				samecoordinatename = name
 				samecoordinateexistingStation = existingStation
-				samecoordinatecoordKey = coordKey
+				samecoordinatecoordKey = coordKey + source.location()
+			}
+			attributes, err := parseAttributes(match[4])
+			if err != nil {
+				attributeflag = true
+				attributeerror = "Invalid attributes for station " + name + ": " + err.Error() + source.location()
 			}
 			coordinates[coordKey] = name
-			network.Stations[name] = &Station{Name: name, X: x, Y: y}
+			addStation(network, &Station{Name: name, X: x, Y: y, Attributes: attributes})
+			if limits.MaxStations > 0 && len(network.StationOrder) > limits.MaxStations {
+				return nil, limitError("stations", limits.MaxStations)
+			}
 		} else if connectionSection {
 			match := connectionRegex.FindStringSubmatch(line)
 			if match == nil {
 				invalidconnectionflag = true
-				invalidconnectionline = line
+				invalidconnectionline = line + source.location()
 				continue
 			}
-			station1, station2 := match[1], match[2]
+			station1, station2 := source.prefix+unquoteName(match[1]), source.prefix+unquoteName(match[2])
 			if station1 == station2 {
 				sameconnectionflag = true
-				sameconnectionstation1 = station1
+				sameconnectionstation1 = station1 + source.location()
 			}
 			if _, exists := network.Stations[station1]; !exists {
 				nonexistingstation1flag = true
-				nonexistingstation1 = station1
+				nonexistingstation1 = station1 + source.location()
 			}
 			if _, exists := network.Stations[station2]; !exists {
 				nonexistingstation2flag = true
-				nonexistingstation2 = station2
+				nonexistingstation2 = station2 + source.location()
 			}
 			if contains(network.Connections[station1], station2) || contains(network.Connections[station2], station1) {
 				duplicateconnectionflag = true
 				duplicatestation1 = station1
-				duplicatestation2 = station2
+				duplicatestation2 = station2 + source.location()
+			}
+			attributes, err := parseAttributes(match[3])
+			if err != nil {
+				attributeflag = true
+				attributeerror = "Invalid attributes for connection " + station1 + "-" + station2 + ": " + err.Error() + source.location()
+			}
+			addConnection(network, station1, station2)
+			if limits.MaxConnections > 0 && len(network.ConnectionOrder) > limits.MaxConnections {
+				return nil, limitError("connections", limits.MaxConnections)
 			}
-			network.Connections[station1] = append(network.Connections[station1], station2)
-			network.Connections[station2] = append(network.Connections[station2], station1)
+			if len(attributes) > 0 {
+				network.ConnectionAttributes[connectionKey(station1, station2)] = attributes
+			}
+		} else if closureSection {
+			closure, err := parseClosureLine(line)
+			if err != nil {
+				closureflag = true
+				closureerror = errors.New(err.Error() + source.location())
+				continue
+			}
+			closure.Station1 = source.prefix + closure.Station1
+			if closure.Station2 != "" {
+				closure.Station2 = source.prefix + closure.Station2
+			}
+			network.Closures = append(network.Closures, closure)
 		}
 	}
 
+	if coordinatesdirectiveflag {
+		return nil, errors.New("Invalid coordinates directive, expected 'coordinates: planar' or 'coordinates: geographic' before the stations: " + coordinatesdirectiveline)
+	}
+
 	if !stationSectionEncountered {
 		return nil, errors.New("Map does not contain a 'stations:' section")
 	}
@@ -196,19 +311,40 @@ func parseNetworkMap(filePath string) (*Network, error) {
 		return nil, errors.New("Duplicate connection between " + duplicatestation1 + " and " + duplicatestation2)
 	}
 
-	// break
-	if len(network.Stations) > 10000 {
-		return nil, errors.New("map contains more than 10,000 stations")
+	if attributeflag {
+		return nil, errors.New(attributeerror)
+	}
+
+	if closureflag {
+		return nil, closureerror
 	}
 
-	if err := scanner.Err(); err != nil {
+	if err := validateClosures(network); err != nil {
 		return nil, err
 	}
 
 	return network, nil
 }
 
-func pathExists(start, end string, network *Network) bool {
+// Check a coordinate: planar coordinates cannot be negative, geographic ones must lie within ±limit degrees
+func validCoordinate(network *Network, value, limit float64) bool {
+	if network.Geographic {
+		return value >= -limit && value <= limit
+	}
+	return value >= 0
+}
+
+// Write a coordinate with as few digits as needed to read it back exactly
+// -0 is written as 0, so the two never count as different coordinates.
+func formatCoordinate(value float64) string {
+	if value == 0 {
+		return "0"
+	}
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// Check if a path exists between two stations using only stations and connections open on the given turn
+func pathExists(start, end string, network *Network, turn int) bool {
 	visited := make(map[string]bool)
 	var dfs func(station string) bool
 	dfs = func(station string) bool {
@@ -217,7 +353,7 @@ func pathExists(start, end string, network *Network) bool {
 		}
 		visited[station] = true
 		for _, neighbor := range network.Connections[station] {
-			if !visited[neighbor] && dfs(neighbor) {
+			if !visited[neighbor] && !moveClosed(network, station, neighbor, turn) && dfs(neighbor) {
 				return true
 			}
 		}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Seed corpus: network.map, and network.map with each of its comment lines turned back into a map line,
+// which brings back the error cases kept in its comments such as the duplicate station and connection
+func addMapSeeds(f *testing.F) {
+	data, err := os.ReadFile("network.map")
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(string(data))
+	lines := strings.Split(string(data), "\n")
+	for i, line := range lines {
+		if !strings.HasPrefix(line, "#") {
+			continue
+		}
+		variant := append([]string(nil), lines...)
+		variant[i] = strings.TrimSpace(strings.TrimPrefix(line, "#"))
+		f.Add(strings.Join(variant, "\n"))
+	}
+	f.Add("coordinates: geographic\nstations:\n\"Tallinn–Balti jaam\",24.737,59.44 platforms=4\nb,-1.5,2\nconnections:\n\"Tallinn–Balti jaam\"-b zone=1\nclosures:\nb,1,2\n")
+	f.Add("stations:\na,1,1\nb,2,2\nconnections:\na-b\nclosures:\na-b,3,1\n")
+	f.Add("coordinates: geographic\nstations:\na,-0,0\nb,0,-0.0\nconnections:\n")
+	f.Add("stations:\na,1,1 note=\"say \\\"hi\\\"\" path=\"C:\\\\maps\"\nb,2,2\nconnections:\na-b\n")
+}
+
+// Fuzz limits, small enough for every input to stay fast
+var fuzzLimits = ParseLimits{MaxStations: 200, MaxConnections: 400, MaxLineLength: 1024}
+
+// Parse a map held in a string, includes are not followed so fuzzed input cannot read other files
+func parseFuzzMap(t *testing.T, data string) (*Network, error) {
+	if strings.Contains(data, "include") {
+		t.Skip("include directives read other files")
+	}
+	return parseNetworkText(strings.NewReader(data), "", fuzzLimits)
+}
+
+// The parser never panics and a map it accepts can be written out and read back unchanged
+func FuzzParseNetworkText(f *testing.F) {
+	addMapSeeds(f)
+	f.Fuzz(func(t *testing.T, data string) {
+		network, err := parseFuzzMap(t, data)
+		if err != nil {
+			return
+		}
+
+		var written bytes.Buffer
+		if err := writeNetworkText(network, &written); err != nil {
+			t.Fatalf("writing the parsed map: %v", err)
+		}
+		again, err := parseNetworkText(strings.NewReader(written.String()), "", fuzzLimits)
+		if err != nil {
+			t.Fatalf("written map does not parse: %v\n%s", err, written.String())
+		}
+		var rewritten bytes.Buffer
+		if err := writeNetworkText(again, &rewritten); err != nil {
+			t.Fatalf("writing the parsed map again: %v", err)
+		}
+		if written.String() != rewritten.String() {
+			t.Fatalf("map changed on the round trip:\n%s\nbecame\n%s", written.String(), rewritten.String())
+		}
+	})
+}
+
+// Path and prefix of every include directive of a map
+func includeDirectives(data string) []string {
+	var directives []string
+	for _, line := range strings.Split(data, "\n") {
+		if match := includeRegex.FindStringSubmatch(strings.TrimSpace(line)); match != nil {
+			directives = append(directives, match[1]+match[2]+" prefix="+match[3])
+		}
+	}
+	return directives
+}
+
+// Formatting never panics, is stable, keeps the include directives pointing at the same files,
+// and keeps a valid map valid with the same stations and connections
+func FuzzFormatRoundTrip(f *testing.F) {
+	addMapSeeds(f)
+	f.Add("include \"r  two.map\"   prefix=r # two  spaces\nstations:\na,1,1\n")
+	f.Fuzz(func(t *testing.T, data string) {
+		tree, err := parseSyntaxTree(strings.NewReader(data))
+		if err != nil {
+			return
+		}
+		var formatted bytes.Buffer
+		if err := tree.format(&formatted); err != nil {
+			t.Fatalf("formatting: %v", err)
+		}
+
+		// Formatting a formatted map changes nothing
+		tree, err = parseSyntaxTree(bytes.NewReader(formatted.Bytes()))
+		if err != nil {
+			t.Fatalf("formatted map has no syntax tree: %v", err)
+		}
+		var reformatted bytes.Buffer
+		if err := tree.format(&reformatted); err != nil {
+			t.Fatalf("formatting again: %v", err)
+		}
+		if formatted.String() != reformatted.String() {
+			t.Fatalf("formatting is not stable:\n%q\nbecame\n%q", formatted.String(), reformatted.String())
+		}
+		if before, after := includeDirectives(data), includeDirectives(formatted.String()); strings.Join(before, "\n") != strings.Join(after, "\n") {
+			t.Fatalf("formatting changed the include directives:\n%q\nbecame\n%q", before, after)
+		}
+
+		// Maps with include directives stop here, as parsing them reads other files
+		network, parseErr := parseFuzzMap(t, data)
+		if parseErr != nil {
+			return
+		}
+		formattedNetwork, err := parseNetworkText(strings.NewReader(formatted.String()), "", fuzzLimits)
+		if err != nil {
+			t.Fatalf("formatted map does not parse: %v\n%s", err, formatted.String())
+		}
+		var before, after bytes.Buffer
+		writeNetworkText(network, &before)
+		writeNetworkText(formattedNetwork, &after)
+		if before.String() != after.String() {
+			t.Fatalf("formatting changed the map:\n%s\nbecame\n%s", before.String(), after.String())
+		}
+	})
+}
+
+// The JSON, GeoJSON and DOT readers never panic on maps detected by their content
+func FuzzParseNetworkFormats(f *testing.F) {
+	network, err := parseNetworkMap("network.map")
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, write := range []func(*Network, io.Writer) error{
+		writeNetworkJSON,
+		writeNetworkGeoJSON,
+		func(network *Network, w io.Writer) error { return writeNetworkDOT(network, w, nil) },
+	} {
+		var seed bytes.Buffer
+		if err := write(network, &seed); err != nil {
+			f.Fatal(err)
+		}
+		f.Add(seed.String())
+	}
+	f.Fuzz(func(t *testing.T, data string) {
+		reader := bufio.NewReader(strings.NewReader(data))
+		switch mapFormat("", reader) {
+		case "json":
+			parseNetworkJSON(reader, fuzzLimits)
+		case "geojson":
+			parseNetworkGeoJSON(reader, fuzzLimits)
+		case "dot":
+			parseNetworkDOT(reader, fuzzLimits)
+		}
+	})
+}
+
+// fmt -w leaves a quoted include path with several spaces in a row alone, so the map still loads
+func TestFormatKeepsIncludePath(t *testing.T) {
+	dir := t.TempDir()
+	included := filepath.Join(dir, "r  two.map")
+	if err := os.WriteFile(included, []byte("stations:\nb,2,2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mapFile := filepath.Join(dir, "main.map")
+	if err := os.WriteFile(mapFile, []byte("stations:\na,1,1\ninclude   \"r  two.map\"\nconnections:\na-b\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parseNetworkMap(mapFile); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(mapFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := parseSyntaxTree(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var formatted bytes.Buffer
+	if err := tree.format(&formatted); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(formatted.String(), `include "r  two.map"`) {
+		t.Fatalf("include path changed by formatting:\n%s", formatted.String())
+	}
+	if err := os.WriteFile(mapFile, formatted.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parseNetworkMap(mapFile); err != nil {
+		t.Fatalf("formatted map does not load: %v\n%s", err, formatted.String())
+	}
+}
+
+// Maps written as DOT read back the same, closures included, also with non-ASCII and control characters
+// in names and values
+func TestDOTRoundTrip(t *testing.T) {
+	network := newNetwork()
+	names := []string{"a\u00a0b", "Tallinn–Balti jaam", "tab\there", `back\slash`, "King's Cross"}
+	for i, name := range names {
+		addStation(network, &Station{Name: name, X: float64(i), Y: float64(i * i), Attributes: []Attribute{{Key: "note", Value: name + "é\\n"}}})
+		if i > 0 {
+			addConnection(network, names[i-1], name)
+		}
+	}
+	network.ConnectionAttributes[connectionKey(names[0], names[1])] = []Attribute{{Key: "display", Value: "x \ty"}}
+	network.Closures = []Closure{{Station1: names[1], From: 2, To: 3}, {Station1: names[3], Station2: names[2], From: 1, To: 4}}
+
+	var want, dot, got bytes.Buffer
+	if err := writeNetworkText(network, &want); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeNetworkDOT(network, &dot, nil); err != nil {
+		t.Fatal(err)
+	}
+	again, err := parseNetworkDOT(strings.NewReader(dot.String()), ParseLimits{})
+	if err != nil {
+		t.Fatalf("written DOT does not parse: %v\n%s", err, dot.String())
+	}
+	if err := writeNetworkText(again, &got); err != nil {
+		t.Fatal(err)
+	}
+	if want.String() != got.String() {
+		t.Fatalf("map changed on the DOT round trip:\n%s\nbecame\n%s", want.String(), got.String())
+	}
+}
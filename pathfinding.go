@@ -1,13 +1,12 @@
 package main
 
 import (
-	"fmt"
 	"reflect"
 )
 
 // errorfunktsioonid wrappituna annavad parema erorrite jada
 // helperfunktsioonid et kergem lugeda oleks
-func dynamicDFS(trainName, startStation, endStation string, network *Network, occupiedStations, usedSegments map[string]bool, trains []*Train, visitedHistory map[string]bool) []string {
+func dynamicDFS(trainName, startStation, endStation string, network *Network, occupiedStations map[string]bool, usedSegments map[[2]string]bool, trains []*Train, visitedHistory map[string]bool, turn int) []string {
 	// Initialize the stack with the start station
 	stack := [][]string{{startStation}}
 	// Slice to store all possible paths
@@ -15,6 +14,15 @@ func dynamicDFS(trainName, startStation, endStation string, network *Network, oc
 	// Initialize variables for the active path
 	var activePath []string
 
+	// Stations this train must never enter
+	var avoid []string
+	for _, train := range trains {
+		if train.Name == trainName {
+			avoid = train.Avoid
+			break
+		}
+	}
+
 	// DFS loop
 	for len(stack) > 0 {
 		// Pop the last path from the stack
@@ -32,7 +40,11 @@ func dynamicDFS(trainName, startStation, endStation string, network *Network, oc
 		// Iterate over all neighbors of the current station
 		for _, neighbor := range network.Connections[currentStation] {
 			// Avoid loops and backtracking
-			if contains(currentPath, neighbor) || visitedHistory[neighbor] {
+			if contains(currentPath, neighbor) || visitedHistory[neighbor] || contains(avoid, neighbor) {
+				continue
+			}
+			// Avoid closures in effect on the turn the train would make this move
+			if moveClosed(network, currentStation, neighbor, turn+len(currentPath)-1) {
 				continue
 			}
 			// Create a new path by copying the current path and adding the neighbor
@@ -120,7 +132,7 @@ func dynamicDFS(trainName, startStation, endStation string, network *Network, oc
 	for _, path := range bestPathCombination {
 		// Check if the next station and the connection are not occupied
 		if len(path) > 1 {
-			segment := fmt.Sprintf("%s-%s", path[0], path[1])
+			segment := [2]string{path[0], path[1]}
 			if !occupiedStations[path[1]] && !usedSegments[segment] {
 				if len(path) < len(activePath) {
 					activePath = path
@@ -140,7 +152,7 @@ func dynamicDFS(trainName, startStation, endStation string, network *Network, oc
 
 		for _, path := range bestPathCombination {
 			if len(path) > 1 {
-				segment := fmt.Sprintf("%s-%s", path[0], path[1])
+				segment := [2]string{path[0], path[1]}
 
 				// Check if the next station and the segment are not occupied
 				if !occupiedStations[path[1]] && !usedSegments[segment] {
@@ -159,7 +171,7 @@ func dynamicDFS(trainName, startStation, endStation string, network *Network, oc
 	alternativePathAvailable := true
 	if len(alternativePath) > 1 {
 		for i := 0; i < len(alternativePath)-1; i++ {
-			segment := fmt.Sprintf("%s-%s", alternativePath[i], alternativePath[i+1])
+			segment := [2]string{alternativePath[i], alternativePath[i+1]}
 			if occupiedStations[alternativePath[i+1]] || usedSegments[segment] {
 				alternativePathAvailable = false
 				break
@@ -171,7 +183,7 @@ func dynamicDFS(trainName, startStation, endStation string, network *Network, oc
 	if !alternativePathAvailable {
 		for _, path := range bestPathCombination {
 			if len(path) > 1 && !reflect.DeepEqual(path, shortestPath) {
-				segment := fmt.Sprintf("%s-%s", path[0], path[1])
+				segment := [2]string{path[0], path[1]}
 				if !occupiedStations[path[1]] && !usedSegments[segment] {
 					alternativePath = path
 					break
@@ -193,7 +205,7 @@ func dynamicDFS(trainName, startStation, endStation string, network *Network, oc
 	// Check availability of the shortest path
 	available := true
 	if len(shortestPath) > 1 {
-		segment := fmt.Sprintf("%s-%s", shortestPath[0], shortestPath[1])
+		segment := [2]string{shortestPath[0], shortestPath[1]}
 		if occupiedStations[shortestPath[1]] || usedSegments[segment] {
 			available = false
 		}
@@ -212,7 +224,7 @@ func dynamicDFS(trainName, startStation, endStation string, network *Network, oc
 	}
 
 	// If no available path was found, return nil
-	if activePath == nil || (len(activePath) > 1 && occupiedStations[activePath[1]] && usedSegments[fmt.Sprintf("%s-%s", activePath[0], activePath[1])]) {
+	if activePath == nil || (len(activePath) > 1 && occupiedStations[activePath[1]] && usedSegments[[2]string{activePath[0], activePath[1]}]) {
 		return nil
 	}
 
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Scenario struct to store one simulation run and the result expected from it
+type Scenario struct {
+	Name      string
+	MapFile   string // relative to the directory of the scenario file
+	Start     string
+	End       string
+	Trains    int
+	MaxTurns  int    // 0 when any number of turns passes
+	Directory string // directory of the scenario file
+}
+
+// ScenarioResult struct to store the outcome of running a scenario
+type ScenarioResult struct {
+	Scenario *Scenario
+	Turns    int
+	Passed   bool
+	Problem  string // why the scenario failed
+	Output   string // movements written by the simulation
+}
+
+// Read a scenario file, keeping the scenarios in the order they are written
+//
+// Every line holds a scenario name, a map file, the start and end stations, the number of trains
+// and an optional maximum number of turns:
+//
+//	test1,network.map,waterloo,st_pancras,2,2 # must finish within 2 turns
+//	big,10000.map,000,001,2                    # must only finish
+func parseScenarios(filePath string) ([]*Scenario, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// Regex to allow flexible whitespace and comments
+	scenarioRegex := regexp.MustCompile(`^\s*([a-zA-Z0-9_]+)\s*,\s*([^,#]+?)\s*,\s*` + namePattern + `\s*,\s*` + namePattern + `\s*,\s*([0-9]+)\s*(?:,\s*([0-9]+)\s*)?(?:#.*)?$`)
+
+	var scenarios []*Scenario
+	names := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+
+		// Ignore blank lines and comments
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		match := scenarioRegex.FindStringSubmatch(line)
+		if match == nil {
+			return nil, fmt.Errorf("Invalid scenario format on line %d: %s", lineNumber, line)
+		}
+		if names[match[1]] {
+			return nil, errors.New("Duplicate scenario name: " + match[1])
+		}
+		names[match[1]] = true
+
+		trains, err := strconv.Atoi(match[5])
+		if err != nil || trains <= 0 {
+			return nil, errors.New("Number of trains is not a valid positive integer in scenario: " + match[1])
+		}
+		maxTurns := 0
+		if match[6] != "" {
+			if maxTurns, err = strconv.Atoi(match[6]); err != nil || maxTurns <= 0 {
+				return nil, errors.New("Maximum number of turns is not a valid positive integer in scenario: " + match[1])
+			}
+		}
+		scenarios = append(scenarios, &Scenario{
+			Name:      match[1],
+			MapFile:   match[2],
+			Start:     unquoteName(match[3]),
+			End:       unquoteName(match[4]),
+			Trains:    trains,
+			MaxTurns:  maxTurns,
+			Directory: filepath.Dir(filePath),
+		})
+	}
+	return scenarios, scanner.Err()
+}
+
+// Find a scenario by its name, nil if there is none
+func findScenario(scenarios []*Scenario, name string) *Scenario {
+	for _, scenario := range scenarios {
+		if scenario.Name == name {
+			return scenario
+		}
+	}
+	return nil
+}
+
+// Path of the scenario map, relative paths start from the directory of the scenario file
+func (scenario *Scenario) mapPath() string {
+	if filepath.IsAbs(scenario.MapFile) {
+		return scenario.MapFile
+	}
+	return filepath.Join(scenario.Directory, scenario.MapFile)
+}
+
+// Check that trains can run between the start and end stations of a network
+func checkStations(network *Network, startStation, endStation string) error {
+	if _, exists := network.Stations[startStation]; !exists {
+		return errors.New("Start station does not exist: " + startStation)
+	}
+	if _, exists := network.Stations[endStation]; !exists {
+		return errors.New("End station does not exist: " + endStation)
+	}
+	if startStation == endStation {
+		return errors.New("Start station: '" + startStation + "' and end station: '" + endStation + "' are the same")
+	}
+	// Closures only last a limited number of turns, so check the path once all of them have ended
+	if !pathExists(startStation, endStation, network, lastClosureTurn(network)+1) {
+		return errors.New(noPathDiagnostics(network, startStation, endStation))
+	}
+	return nil
+}
+
+// Load the map of a scenario and simulate its trains
+func runScenario(scenario *Scenario) ScenarioResult {
+	result := ScenarioResult{Scenario: scenario}
+	network, err := parseNetworkMap(scenario.mapPath())
+	if err == nil {
+		err = checkStations(network, scenario.Start, scenario.End)
+	}
+	if err != nil {
+		result.Problem = err.Error()
+		return result
+	}
+
+	var output bytes.Buffer
+	simulation := simulateTrains(network, scenario.Start, scenario.End, newTrains(scenario.Trains, scenario.Start), nil, &output)
+	result.Turns = simulation.Turns
+	result.Output = output.String()
+	switch {
+	case !simulation.Completed:
+		result.Problem = fmt.Sprintf("not every train arrived, stopped after %d turns", simulation.Turns)
+	case scenario.MaxTurns > 0 && simulation.Turns > scenario.MaxTurns:
+		result.Problem = fmt.Sprintf("took %d turns, expected at most %d", simulation.Turns, scenario.MaxTurns)
+	default:
+		result.Passed = true
+	}
+	return result
+}
+
+// Run the scenarios on the given number of workers, the results keep the order of the scenarios
+func runScenarios(scenarios []*Scenario, workers int) []ScenarioResult {
+	if workers < 1 {
+		workers = 1
+	}
+	results := make([]ScenarioResult, len(scenarios))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = runScenario(scenarios[i])
+			}
+		}()
+	}
+	for i := range scenarios {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+// Print a line for every scenario result and a summary, with the movements when verbose is set
+// Returns the number of failed scenarios.
+func printScenarioResults(results []ScenarioResult, verbose bool, out io.Writer) int {
+	failed := 0
+	for _, result := range results {
+		scenario := result.Scenario
+		if verbose {
+			fmt.Fprintf(out, "\nRunning %s: %s %s %s %d\n", scenario.Name, scenario.MapFile, quoteName(scenario.Start), quoteName(scenario.End), scenario.Trains)
+			fmt.Fprint(out, result.Output)
+		}
+		if result.Passed {
+			fmt.Fprintf(out, "PASS %s (%d turns)\n", scenario.Name, result.Turns)
+			continue
+		}
+		failed++
+		fmt.Fprintf(out, "FAIL %s: %s\n", scenario.Name, result.Problem)
+	}
+	fmt.Fprintf(out, "%d of %d scenarios passed\n", len(results)-failed, len(results))
+	return failed
+}
+
+// run-scenarios command: go run . run-scenarios [-parallel n] [-run name,name] [-v] <scenario file>
+func runRunScenarios(args []string) {
+	flags := flag.NewFlagSet("run-scenarios", flag.ExitOnError)
+	parallel := flags.Int("parallel", runtime.NumCPU(), "number of scenarios run at the same time")
+	only := flags.String("run", "", "comma-separated names of the scenarios to run, all of them by default")
+	verbose := flags.Bool("v", false, "print the movements of every scenario")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		handleError("Usage: run-scenarios [-parallel n] [-run names] [-v] <scenario file>")
+	}
+
+	scenarios, err := parseScenarios(flags.Arg(0))
+	if err != nil {
+		handleError(err.Error())
+	}
+	if *only != "" {
+		var selected []*Scenario
+		for _, name := range strings.Split(*only, ",") {
+			scenario := findScenario(scenarios, name)
+			if scenario == nil {
+				handleError("Unknown scenario: " + name)
+			}
+			selected = append(selected, scenario)
+		}
+		scenarios = selected
+	}
+
+	if printScenarioResults(runScenarios(scenarios, *parallel), *verbose, os.Stdout) > 0 {
+		os.Exit(1)
+	}
+}
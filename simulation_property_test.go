@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// simulationCase struct to store a randomly generated simulation run
+type simulationCase struct {
+	network *Network
+	start   string
+	end     string
+	trains  int
+}
+
+// Describe a case as a runnable map and command line
+func (c simulationCase) String() string {
+	var text strings.Builder
+	writeNetworkText(c.network, &text)
+	return fmt.Sprintf("%s %s %d\n%s", quoteName(c.start), quoteName(c.end), c.trains, text.String())
+}
+
+// Generate a small random network with start and end stations and a train count
+// The networks stay small because the planner looks at every route between the stations.
+func randomSimulationCase(rng *rand.Rand) simulationCase {
+	network := newNetwork()
+	stations := 2 + rng.Intn(6)
+	for i := 0; i < stations; i++ {
+		addStation(network, &Station{Name: generatedName(i), X: float64(i), Y: float64(rng.Intn(10))})
+	}
+	connections := rng.Intn(2 * stations)
+	for i := 0; i < connections; i++ {
+		station1, station2 := generatedName(rng.Intn(stations)), generatedName(rng.Intn(stations))
+		if station1 != station2 && !contains(network.Connections[station1], station2) {
+			addConnection(network, station1, station2)
+		}
+	}
+	start := generatedName(rng.Intn(stations))
+	end := generatedName(rng.Intn(stations))
+	for end == start {
+		end = generatedName(rng.Intn(stations))
+	}
+	return simulationCase{network: network, start: start, end: end, trains: 1 + rng.Intn(6)}
+}
+
+// Run the simulation of a case and return the first broken invariant, empty when there is none:
+// every move follows a connection from the station the train is at, no station other than the
+// terminals holds more than one train, no connection carries more than one train per turn,
+// and all trains finish whenever a path exists
+func checkSimulationInvariants(c simulationCase) string {
+	trains := newTrains(c.trains, c.start)
+	var output bytes.Buffer
+	result := simulateTrains(c.network, c.start, c.end, trains, nil, &output)
+
+	// The movement output is checked turn by turn against the rules
+	verified, err := verifySchedule(c.network, c.start, c.end, c.trains, strings.NewReader(output.String()))
+	if err != nil {
+		return err.Error()
+	}
+	reachable := pathExists(c.start, c.end, c.network, 1)
+	for _, violation := range verified.Violations {
+		if violation.Turn == 0 && !reachable {
+			// Trains that cannot reach the end are only a violation when a path exists
+			continue
+		}
+		return fmt.Sprintf("turn %d: %s", violation.Turn, violation.Message)
+	}
+
+	// The routes the trains report never jump between stations that are not connected
+	for _, train := range trains {
+		for i := 1; i < len(train.Route); i++ {
+			if !contains(c.network.Connections[train.Route[i-1]], train.Route[i]) {
+				return fmt.Sprintf("%s jumps from %s to %s", train.Name, train.Route[i-1], train.Route[i])
+			}
+		}
+	}
+
+	if reachable && !result.Completed {
+		return fmt.Sprintf("not every train finished although a path exists, stopped after %d turns", result.Turns)
+	}
+	if !reachable && result.Completed {
+		return "trains finished although no path exists"
+	}
+	return ""
+}
+
+// Copy of a network without the given station and its connections, or without a single connection
+func reducedNetwork(network *Network, removedStation string, removedConnection [2]string) *Network {
+	reduced := newNetwork()
+	for _, name := range network.StationOrder {
+		if name != removedStation {
+			station := *network.Stations[name]
+			addStation(reduced, &station)
+		}
+	}
+	for _, connection := range network.ConnectionOrder {
+		if connection == removedConnection || connection[0] == removedStation || connection[1] == removedStation {
+			continue
+		}
+		addConnection(reduced, connection[0], connection[1])
+	}
+	return reduced
+}
+
+// Shrink a failing case to a smaller one that still fails: fewer trains, fewer connections, fewer stations
+func shrinkSimulationCase(c simulationCase) simulationCase {
+	for shrunk := true; shrunk; {
+		shrunk = false
+		var candidates []simulationCase
+		if c.trains > 1 {
+			candidates = append(candidates, simulationCase{c.network, c.start, c.end, c.trains - 1})
+		}
+		for _, connection := range c.network.ConnectionOrder {
+			candidates = append(candidates, simulationCase{reducedNetwork(c.network, "", connection), c.start, c.end, c.trains})
+		}
+		for _, name := range c.network.StationOrder {
+			if name != c.start && name != c.end {
+				candidates = append(candidates, simulationCase{reducedNetwork(c.network, name, [2]string{}), c.start, c.end, c.trains})
+			}
+		}
+		for _, candidate := range candidates {
+			if checkSimulationInvariants(candidate) != "" {
+				c, shrunk = candidate, true
+				break
+			}
+		}
+	}
+	return c
+}
+
+func TestSimulationInvariants(t *testing.T) {
+	cases := 500
+	if testing.Short() {
+		cases = 50
+	}
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < cases; i++ {
+		c := randomSimulationCase(rng)
+		if problem := checkSimulationInvariants(c); problem != "" {
+			minimal := shrinkSimulationCase(c)
+			t.Fatalf("case %d: %s\nshrunk to: %s\n%s", i, problem, checkSimulationInvariants(minimal), minimal)
+		}
+	}
+}
+
+// Without closures a train waits for the one ahead rather than taking a detour, which is quicker on this map
+func TestWaitingBeatsDetour(t *testing.T) {
+	const networkMap = `stations:
+s0,1,7
+s1,7,19
+s2,1,38
+s3,25,20
+s4,16,20
+s5,31,2
+s6,34,11
+s7,37,26
+s8,8,18
+s9,27,7
+connections:
+s0-s1
+s0-s2
+s1-s2
+s0-s3
+s1-s3
+s2-s3
+s0-s4
+s2-s5
+s1-s5
+s3-s6
+s5-s7
+s0-s7
+s5-s8
+s2-s9
+s3-s9
+`
+	network, err := parseNetworkText(strings.NewReader(networkMap), "", ParseLimits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := simulateTrains(network, "s5", "s1", newTrains(7, "s5"), nil, io.Discard)
+	if !result.Completed || result.Turns != 5 {
+		t.Fatalf("7 trains from s5 to s1 took %d turns (completed: %v), want 5", result.Turns, result.Completed)
+	}
+}
@@ -1,11 +1,16 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 )
 
+// Scenario file holding the predefined test cases
+const scenarioFile = "scenarios.txt"
+
 // Error handling
 func handleError(msg string) {
 	fmt.Fprintln(os.Stderr, "Error:", msg)
@@ -22,8 +27,49 @@ func contains(slice []string, element string) bool {
 	return false
 }
 
+// Commands run with "go run . <command> <arguments>"
+var commands = map[string]func(args []string){
+	"analyze":       runAnalyze,
+	"bench-compare": runBenchCompare,
+	"components":    runComponents,
+	"convert":       runConvert,
+	"diff":          runDiff,
+	"fmt":           runFormat,
+	"generate":      runGenerate,
+	"lint":          runLint,
+	"merge":         runMerge,
+	"run-scenarios": runRunScenarios,
+	"stats":         runStats,
+	"verify":        runVerify,
+}
+
 func main() {
-	if len(os.Args) != 2 && len(os.Args) != 5 {
+	timetableFile := flag.String("timetable", "", "file with departure turns and arrival deadlines for the trains")
+	closuresFile := flag.String("closures", "", "file with planned closures of stations and connections")
+	seed := flag.Int64("seed", 1, "seed for random disruptions")
+	segmentProbability := flag.Float64("disrupt-segment", 0, "chance per turn that a random connection is blocked")
+	stationProbability := flag.Float64("disrupt-station", 0, "chance per turn that a random station is closed")
+	holdProbability := flag.Float64("disrupt-hold", 0, "chance per turn that a random train is held at its station")
+	disruptionDuration := flag.Int("disrupt-duration", 3, "number of turns each disruption lasts")
+	constraintsFile := flag.String("constraints", "", "file with via and avoid stations for the trains")
+	returnTrips := flag.Int("trips", 0, "run the trains as shuttles making this many return trips between the terminals")
+	dotFile := flag.String("dot", "", "write the network with the routes taken by the trains to this Graphviz DOT file")
+	flag.IntVar(&defaultParseLimits.MaxStations, "max-stations", defaultParseLimits.MaxStations, "maximum number of stations in a map, 0 for no limit")
+	flag.IntVar(&defaultParseLimits.MaxConnections, "max-connections", defaultParseLimits.MaxConnections, "maximum number of connections in a map, 0 for no limit")
+	flag.IntVar(&defaultParseLimits.MaxLineLength, "max-line-length", defaultParseLimits.MaxLineLength, "maximum length of a map line in bytes, 0 for no limit")
+	monteCarloRuns := flag.Int("montecarlo", 0, "run the simulation with this many seeds and report robustness statistics")
+	flag.Parse()
+	args := flag.Args()
+
+	// Commands take their own arguments
+	if len(args) > 0 {
+		if command, exists := commands[args[0]]; exists {
+			command(args[1:])
+			return
+		}
+	}
+
+	if len(args) != 1 && len(args) != 4 {
 		handleError("Incorrect number of command line arguments")
 	}
 
@@ -31,44 +77,28 @@ func main() {
 	var numTrains int
 	var err error
 
-	// Predefined test cases
-	tests := map[string][]string{
-		"test1": {"waterloo", "st_pancras", "2"},
-		"test2": {"bond_square", "space_port", "4"},
-		"test3": {"beethoven", "part", "9"},
-		"test4": {"beginning", "terminus", "20"},
-		"test5": {"two", "four", "4"},
-		"test6": {"jungle", "desert", "10"},
-		"test7": {"small", "large", "9"},
-	}
-
 	// eraldi funktsioonina parem testida, flagiga test case'd
-	if len(os.Args) == 2 {
-		testName := os.Args[1]
+	// Predefined test cases are the scenarios in scenarios.txt
+	if len(args) == 1 {
+		testName := args[0]
 		if testName == "test0" {
 			fmt.Println("Running all tests")
-			for name, args := range tests {
-				fmt.Printf("\nRunning %s: %s %s %s\n", name, args[0], args[1], args[2])
-				numTrains, err = strconv.Atoi(args[2])
-				if err != nil || numTrains <= 0 {
-					handleError("Number of trains is not a valid positive integer")
-				}
-				network, err := parseNetworkMap("network.map")
-				if err != nil {
-					handleError(err.Error())
-				}
-				simulateTrains(network, args[0], args[1], numTrains)
-			}
+			runRunScenarios([]string{"-v", scenarioFile})
 			return
-		} else if args, exists := tests[testName]; exists {
-			fmt.Printf("Running %s: %s %s %s\n", testName, args[0], args[1], args[2])
-			mapFile = "network.map"
-			startStation = args[0]
-			endStation = args[1]
-			numTrains, err = strconv.Atoi(args[2])
-			if err != nil || numTrains <= 0 {
-				handleError("Number of trains is not a valid positive integer")
+		} else if strings.HasPrefix(testName, "test") {
+			scenarios, err := parseScenarios(scenarioFile)
+			if err != nil {
+				handleError(err.Error())
+			}
+			test := findScenario(scenarios, testName)
+			if test == nil {
+				handleError("Unknown test name")
 			}
+			fmt.Printf("Running %s: %s %s %d\n", testName, test.Start, test.End, test.Trains)
+			mapFile = test.mapPath()
+			startStation = test.Start
+			endStation = test.End
+			numTrains = test.Trains
 		} else if testName == "10000" {
 			fmt.Println("Running test for large map")
 			mapFile = "10000.map"
@@ -79,10 +109,10 @@ func main() {
 			handleError("Unknown test name")
 		}
 	} else {
-		mapFile = os.Args[1]
-		startStation = os.Args[2]
-		endStation = os.Args[3]
-		numTrains, err = strconv.Atoi(os.Args[4])
+		mapFile = args[0]
+		startStation = args[1]
+		endStation = args[2]
+		numTrains, err = strconv.Atoi(args[3])
 		if err != nil || numTrains <= 0 {
 			handleError("Number of trains is not a valid positive integer")
 		}
@@ -93,22 +123,65 @@ func main() {
 		handleError(err.Error())
 	}
 
-	if _, exists := network.Stations[startStation]; !exists {
-		handleError("Start station does not exist: " + startStation)
+	if *closuresFile != "" {
+		if err := parseClosures(*closuresFile, network); err != nil {
+			handleError(err.Error())
+		}
 	}
 
-	if _, exists := network.Stations[endStation]; !exists {
-		handleError("End station does not exist: " + endStation)
+	if err := checkStations(network, startStation, endStation); err != nil {
+		handleError(err.Error())
 	}
 
-	if startStation == endStation {
-		handleError("Start station: '" + startStation + "' and end station: '" + endStation + "' are the same")
+	trains := newTrains(numTrains, startStation)
+	if *returnTrips < 0 {
+		handleError("Number of return trips is not a valid positive integer")
+	}
+	if *returnTrips > 0 {
+		setReturnTrips(trains, *returnTrips)
+	}
+	if *constraintsFile != "" {
+		if err := parseConstraints(*constraintsFile, trains); err != nil {
+			handleError(err.Error())
+		}
+	}
+	if err := checkTrainConstraints(network, startStation, endStation, trains); err != nil {
+		handleError(err.Error())
+	}
+	if *timetableFile != "" {
+		if err := parseTimetable(*timetableFile, trains); err != nil {
+			handleError(err.Error())
+		}
+	}
+
+	// Disruptions are only injected when at least one of them can happen
+	var disruptions *DisruptionModel
+	if *segmentProbability > 0 || *stationProbability > 0 || *holdProbability > 0 || *monteCarloRuns > 0 {
+		if *disruptionDuration <= 0 {
+			handleError("Disruption duration is not a valid positive integer")
+		}
+		disruptions = newDisruptionModel(*segmentProbability, *stationProbability, *holdProbability, *disruptionDuration, *seed)
 	}
 
-	if !pathExists(startStation, endStation, network) {
-		handleError("No path exists between the start station: '" + startStation + "' and end station: '" + endStation + "'")
+	if *monteCarloRuns < 0 {
+		handleError("Number of Monte Carlo runs is not a valid positive integer")
+	}
+	if *monteCarloRuns > 0 {
+		runMonteCarlo(network, startStation, endStation, trains, disruptions, *monteCarloRuns, os.Stdout)
+		return
 	}
 
 	// Simulate trains on the dynamic path
-	simulateTrains(network, startStation, endStation, numTrains)
+	simulateTrains(network, startStation, endStation, trains, disruptions, os.Stdout)
+
+	if *dotFile != "" {
+		file, err := os.Create(*dotFile)
+		if err != nil {
+			handleError(err.Error())
+		}
+		defer file.Close()
+		if err := writeNetworkDOT(network, file, trainRoutes(trains)); err != nil {
+			handleError(err.Error())
+		}
+	}
 }
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// NetworkStats struct to store the structural statistics of a network
+// Distances are counted in connections and only between stations that are connected to each other
+type NetworkStats struct {
+	Stations           int         `json:"stations"`
+	Connections        int         `json:"connections"`
+	DegreeDistribution map[int]int `json:"degree_distribution"`
+	Diameter           int         `json:"diameter"`
+	AveragePathLength  float64     `json:"average_path_length"`
+	DeadEnds           int         `json:"dead_ends"`
+	Components         int         `json:"components"`
+	BoundingBox        BoundingBox `json:"bounding_box"`
+}
+
+// BoundingBox struct to store the smallest rectangle holding every station
+type BoundingBox struct {
+	MinX float64 `json:"min_x"`
+	MinY float64 `json:"min_y"`
+	MaxX float64 `json:"max_x"`
+	MaxY float64 `json:"max_y"`
+}
+
+// Compute the statistics of a network
+func networkStats(network *Network) NetworkStats {
+	names := sortedStationNames(network)
+	index := make(map[string]int)
+	for i, name := range names {
+		index[name] = i
+	}
+
+	stats := NetworkStats{
+		Stations:           len(names),
+		DegreeDistribution: make(map[int]int),
+		Components:         len(connectedComponents(network)),
+	}
+
+	// Degrees, dead ends and connection count
+	neighbors := make([][]int, len(names))
+	for i, name := range names {
+		degree := len(network.Connections[name])
+		stats.DegreeDistribution[degree]++
+		stats.Connections += degree
+		if degree == 1 {
+			stats.DeadEnds++
+		}
+		for _, neighbor := range network.Connections[name] {
+			neighbors[i] = append(neighbors[i], index[neighbor])
+		}
+	}
+	stats.Connections /= 2
+
+	// Bounding box
+	for i, name := range names {
+		station := network.Stations[name]
+		if i == 0 || station.X < stats.BoundingBox.MinX {
+			stats.BoundingBox.MinX = station.X
+		}
+		if i == 0 || station.Y < stats.BoundingBox.MinY {
+			stats.BoundingBox.MinY = station.Y
+		}
+		if i == 0 || station.X > stats.BoundingBox.MaxX {
+			stats.BoundingBox.MaxX = station.X
+		}
+		if i == 0 || station.Y > stats.BoundingBox.MaxY {
+			stats.BoundingBox.MaxY = station.Y
+		}
+	}
+
+	// Breadth-first search from every station for the diameter and average path length
+	totalLength, pairs := 0, 0
+	distance := make([]int, len(names))
+	for source := range names {
+		for i := range distance {
+			distance[i] = -1
+		}
+		distance[source] = 0
+		queue := []int{source}
+		for len(queue) > 0 {
+			station := queue[0]
+			queue = queue[1:]
+			for _, neighbor := range neighbors[station] {
+				if distance[neighbor] == -1 {
+					distance[neighbor] = distance[station] + 1
+					queue = append(queue, neighbor)
+				}
+			}
+		}
+		for target, d := range distance {
+			if target == source || d == -1 {
+				continue
+			}
+			totalLength += d
+			pairs++
+			if d > stats.Diameter {
+				stats.Diameter = d
+			}
+		}
+	}
+	if pairs > 0 {
+		stats.AveragePathLength = float64(totalLength) / float64(pairs)
+	}
+
+	return stats
+}
+
+// stats command: go run . stats [-json] <map>
+func runStats(args []string) {
+	flags := flag.NewFlagSet("stats", flag.ExitOnError)
+	jsonOutput := flags.Bool("json", false, "print the statistics as JSON")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		handleError("Usage: stats [-json] <map file>")
+	}
+
+	network, err := parseNetworkMap(flags.Arg(0))
+	if err != nil {
+		handleError(err.Error())
+	}
+	stats := networkStats(network)
+
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(stats); err != nil {
+			handleError(err.Error())
+		}
+		return
+	}
+
+	fmt.Printf("Stations: %d\n", stats.Stations)
+	fmt.Printf("Connections: %d\n", stats.Connections)
+	fmt.Println("Degree distribution:")
+	degrees := make([]int, 0, len(stats.DegreeDistribution))
+	for degree := range stats.DegreeDistribution {
+		degrees = append(degrees, degree)
+	}
+	sort.Ints(degrees)
+	for _, degree := range degrees {
+		fmt.Printf("  %d: %d\n", degree, stats.DegreeDistribution[degree])
+	}
+	fmt.Printf("Diameter: %d\n", stats.Diameter)
+	fmt.Printf("Average shortest path length: %.2f\n", stats.AveragePathLength)
+	fmt.Printf("Dead-end stations: %d\n", stats.DeadEnds)
+	fmt.Printf("Components: %d\n", stats.Components)
+	box := stats.BoundingBox
+	fmt.Printf("Bounding box: (%s,%s) to (%s,%s)\n", formatCoordinate(box.MinX), formatCoordinate(box.MinY), formatCoordinate(box.MaxX), formatCoordinate(box.MaxY))
+}
@@ -1,10 +1,18 @@
 package main
 
 // Station struct to store station data
+// On geographic maps X is the longitude and Y the latitude in degrees
 type Station struct {
-	Name string
-	X    int
-	Y    int
+	Name       string
+	X          float64
+	Y          float64
+	Attributes []Attribute // optional key=value pairs such as display, zone, platforms and type
+}
+
+// Attribute struct to store a key=value pair of a station or connection
+type Attribute struct {
+	Key   string
+	Value string
 }
 
 // Train struct to store train data
@@ -12,6 +20,33 @@ type Train struct {
 	Name         string
 	Current      string
 	AssignedPath []string
+	Departure    int // earliest turn the train may leave its start station
+	Deadline     int // latest turn the train should arrive by, 0 if it has none
+	Arrival      int // turn the train reached the end station, 0 until it does
+	HeldUntil    int // last turn the train is held at its current station by a disruption
+	Legs         int // number of legs to run, 1 for a one-way trip, two per return trip for shuttles
+	Leg          int // index of the current leg, even legs head to the end station and odd legs back
+	LegArrivals  []int
+	Via          []string // stations the train must pass, in order
+	ViaIndex     int      // number of via stations already passed
+	Avoid        []string // stations the train must never enter
+	Route        []string // stations the train has travelled through, starting with its start station
+	Detour       bool     // the assigned path was planned around a closure
+	Blocked      int      // consecutive turns the next station of the assigned path was closed or held up
+}
+
+// SimulationResult struct to store the outcome of a simulation
+type SimulationResult struct {
+	Turns     int  // number of turns the simulation ran for
+	Completed bool // false if the simulation ended with trains stuck
+}
+
+// Closure struct to store a planned closure of a station or connection between two turns (inclusive)
+type Closure struct {
+	Station1 string
+	Station2 string // empty when the whole station is closed
+	From     int
+	To       int
 }
 
 // Network struct to store the whole network graph
@@ -19,4 +54,11 @@ type Network struct {
 	Stations    map[string]*Station
 	Connections map[string][]string
 	Paths       map[string]map[string][]string
+	Closures    []Closure
+	Geographic  bool // coordinates are longitude/latitude instead of points on a plane
+
+	StationOrder    []string    // station names in the order they were defined
+	ConnectionOrder [][2]string // connections in the order they were defined
+
+	ConnectionAttributes map[[2]string][]Attribute // attributes of connections, by connectionKey
 }
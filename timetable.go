@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Read the timetable file and set the departure turns and deadlines of the given trains
+//
+// Every line holds a train name, its earliest departure turn and an optional latest arrival turn:
+//
+//	T1,1,4 # leaves on turn 1, must arrive by turn 4
+//	T2,3   # leaves on turn 3, no deadline
+func parseTimetable(filePath string, trains []*Train) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	trainsByName := make(map[string]*Train)
+	for _, train := range trains {
+		trainsByName[train.Name] = train
+	}
+	scheduled := make(map[string]bool)
+
+	// Regex to allow flexible whitespace and comments
+	timetableRegex := regexp.MustCompile(`^\s*([a-zA-Z0-9_]+)\s*,\s*([0-9]+)\s*(?:,\s*([0-9]+)\s*)?(?:#.*)?$`)
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		// Ignore blank lines and comments
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		match := timetableRegex.FindStringSubmatch(line)
+		if match == nil {
+			return errors.New("Invalid timetable format: " + line)
+		}
+		name := match[1]
+		train, exists := trainsByName[name]
+		if !exists {
+			return errors.New("Timetable entry for non-existing train: " + name)
+		}
+		if scheduled[name] {
+			return errors.New("Duplicate timetable entry for train: " + name)
+		}
+		scheduled[name] = true
+
+		departure, err := strconv.Atoi(match[2])
+		if err != nil || departure < 1 {
+			return errors.New("Invalid departure turn for train: " + name)
+		}
+		deadline := 0
+		if match[3] != "" {
+			deadline, err = strconv.Atoi(match[3])
+			if err != nil || deadline < departure {
+				return errors.New("Deadline before departure turn for train: " + name)
+			}
+		}
+		train.Departure = departure
+		train.Deadline = deadline
+	}
+
+	return scanner.Err()
+}
+
+// Print the trains that missed their deadlines and by how many turns
+func printDeadlineReport(trains []*Train, out io.Writer) {
+	hasDeadlines := false
+	var missed []string
+	for _, train := range trains {
+		if train.Deadline == 0 {
+			continue
+		}
+		hasDeadlines = true
+		if train.Arrival == 0 {
+			missed = append(missed, fmt.Sprintf("%s never arrived (deadline turn %d)", train.Name, train.Deadline))
+		} else if train.Arrival > train.Deadline {
+			missed = append(missed, fmt.Sprintf("%s arrived on turn %d, missing its deadline (turn %d) by %d turns", train.Name, train.Arrival, train.Deadline, train.Arrival-train.Deadline))
+		}
+	}
+
+	if !hasDeadlines {
+		return
+	}
+	if len(missed) == 0 {
+		fmt.Fprintln(out, "All trains met their deadlines.")
+		return
+	}
+	fmt.Fprintln(out, "Missed deadlines:")
+	for _, line := range missed {
+		fmt.Fprintln(out, "  "+line)
+	}
+}
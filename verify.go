@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Violation struct to store a broken rule found in a movement transcript
+type Violation struct {
+	Turn    int // 0 for violations of the whole schedule
+	Message string
+}
+
+// VerifyResult struct to store the outcome of checking a movement transcript
+type VerifyResult struct {
+	Turns      int
+	Violations []Violation
+}
+
+var (
+	// "Turn 3:" optionally followed by the moves of the turn on the same line
+	turnRegex = regexp.MustCompile(`^Turn\s+([0-9]+):\s*(.*)$`)
+	// A single move such as T1-euston or T2-"King's Cross"
+	moveRegex = regexp.MustCompile(`^([a-zA-Z0-9_]+)-` + namePattern + `(?:\s+|$)`)
+	// Disruptions written by simulateTrains, which change the rules from their turn on
+	blockedRegex = regexp.MustCompile(`^Disruption:\s*` + namePattern + `-` + namePattern + `\s+blocked until turn\s+([0-9]+)$`)
+	closedRegex  = regexp.MustCompile(`^Disruption:\s*` + namePattern + `\s+closed until turn\s+([0-9]+)$`)
+	heldRegex    = regexp.MustCompile(`^Disruption:\s*([a-zA-Z0-9_]+)\s+held at\s+` + namePattern + `\s+until turn\s+([0-9]+)$`)
+)
+
+// Split a line of moves into train and station pairs, ok is false when the line is not made of moves only
+func parseMoves(line string) ([][2]string, bool) {
+	var moves [][2]string
+	rest := strings.TrimSpace(line)
+	for rest != "" {
+		match := moveRegex.FindStringSubmatch(rest)
+		if match == nil {
+			return moves, false
+		}
+		moves = append(moves, [2]string{match[1], unquoteName(match[2])})
+		rest = rest[len(match[0]):]
+	}
+	return moves, true
+}
+
+// Check a movement transcript of numTrains trains from the start station to the end station against every rule:
+// each move follows a connection that is open, no two trains share a station other than the start and end,
+// no connection is used twice in one turn and every train reaches the end
+//
+// Lines other than turns, moves and disruptions, such as the closing message and the reports, are skipped.
+func verifySchedule(network *Network, startStation, endStation string, numTrains int, transcript io.Reader) (VerifyResult, error) {
+	var result VerifyResult
+	// Disruptions add closures, keep them away from the caller's network
+	runNetwork := *network
+	runNetwork.Closures = append([]Closure(nil), network.Closures...)
+	network = &runNetwork
+
+	trains := newTrains(numTrains, startStation)
+	trainsByName := make(map[string]*Train)
+	for _, train := range trains {
+		trainsByName[train.Name] = train
+	}
+	violation := func(turn int, format string, args ...interface{}) {
+		result.Violations = append(result.Violations, Violation{Turn: turn, Message: fmt.Sprintf(format, args...)})
+	}
+
+	turn := 0
+	inTurn := false
+	movedThisTurn := make(map[string]bool)
+	usedSegments := make(map[[2]string]bool)
+
+	// Check that no two trains share a station once every move of the turn has been made
+	endTurn := func() {
+		if turn == 0 {
+			return
+		}
+		occupiedBy := make(map[string]string)
+		for _, train := range trains {
+			if train.Current == startStation || train.Current == endStation {
+				continue
+			}
+			if other, exists := occupiedBy[train.Current]; exists {
+				violation(turn, "%s and %s are both at %s", other, train.Name, quoteName(train.Current))
+				continue
+			}
+			occupiedBy[train.Current] = train.Name
+		}
+	}
+
+	move := func(trainName, station string) {
+		train, exists := trainsByName[trainName]
+		switch {
+		case !exists:
+			violation(turn, "unknown train %s", trainName)
+			return
+		case movedThisTurn[trainName]:
+			violation(turn, "%s moves more than once", trainName)
+			return
+		}
+		movedThisTurn[trainName] = true
+		from := train.Current
+		switch {
+		case network.Stations[station] == nil:
+			violation(turn, "%s moves to %s, which does not exist", trainName, quoteName(station))
+			return
+		case from == endStation:
+			violation(turn, "%s moves on after reaching %s", trainName, quoteName(endStation))
+		case !contains(network.Connections[from], station):
+			violation(turn, "%s moves from %s to %s, which are not connected", trainName, quoteName(from), quoteName(station))
+		case turn <= train.HeldUntil:
+			violation(turn, "%s moves while held at %s", trainName, quoteName(from))
+		case moveClosed(network, from, station, turn):
+			violation(turn, "%s moves from %s to %s while it is closed", trainName, quoteName(from), quoteName(station))
+		}
+		// Trains cannot pass each other on a connection either
+		segment := connectionKey(from, station)
+		if usedSegments[segment] {
+			violation(turn, "connection %s-%s is used more than once", quoteName(from), quoteName(station))
+		}
+		usedSegments[segment] = true
+		train.Current = station
+	}
+
+	scanner := bufio.NewScanner(transcript)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if match := turnRegex.FindStringSubmatch(line); match != nil {
+			endTurn()
+			next, _ := strconv.Atoi(match[1])
+			if next != turn+1 {
+				violation(next, "turn %d follows turn %d", next, turn)
+			}
+			turn, inTurn = next, true
+			movedThisTurn = make(map[string]bool)
+			usedSegments = make(map[[2]string]bool)
+			line = match[2]
+		}
+		if !inTurn || line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "Disruption:") {
+			if match := blockedRegex.FindStringSubmatch(line); match != nil {
+				to, _ := strconv.Atoi(match[3])
+				network.Closures = append(network.Closures, Closure{Station1: unquoteName(match[1]), Station2: unquoteName(match[2]), From: turn, To: to})
+			} else if match := closedRegex.FindStringSubmatch(line); match != nil {
+				to, _ := strconv.Atoi(match[2])
+				network.Closures = append(network.Closures, Closure{Station1: unquoteName(match[1]), From: turn, To: to})
+			} else if match := heldRegex.FindStringSubmatch(line); match != nil && trainsByName[match[1]] != nil {
+				trainsByName[match[1]].HeldUntil, _ = strconv.Atoi(match[3])
+			} else {
+				violation(turn, "unknown disruption: %s", line)
+			}
+			continue
+		}
+
+		moves, ok := parseMoves(line)
+		if !ok {
+			// A line starting like a move is a broken one, anything else ends the moves of the turn
+			if moveRegex.MatchString(line) {
+				violation(turn, "invalid movement line: %s", line)
+			} else {
+				inTurn = false
+			}
+			continue
+		}
+		for _, m := range moves {
+			move(m[0], m[1])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return result, err
+	}
+	endTurn()
+
+	result.Turns = turn
+	for _, train := range trains {
+		if train.Current != endStation {
+			violation(0, "%s never reaches %s, it ends at %s", train.Name, quoteName(endStation), quoteName(train.Current))
+		}
+	}
+	return result, nil
+}
+
+// verify command: go run . verify <map> <start station> <end station> <number of trains> [transcript file]
+func runVerify(args []string) {
+	if len(args) != 4 && len(args) != 5 {
+		handleError("Usage: verify <map file> <start station> <end station> <number of trains> [transcript file]")
+	}
+	network, err := parseNetworkMap(args[0])
+	if err != nil {
+		handleError(err.Error())
+	}
+	startStation, endStation := args[1], args[2]
+	if err := checkStations(network, startStation, endStation); err != nil {
+		handleError(err.Error())
+	}
+	numTrains, err := strconv.Atoi(args[3])
+	if err != nil || numTrains <= 0 {
+		handleError("Number of trains is not a valid positive integer")
+	}
+
+	// The transcript is read from standard input unless a file is given
+	transcript := io.Reader(os.Stdin)
+	if len(args) == 5 && args[4] != "-" {
+		file, err := os.Open(args[4])
+		if err != nil {
+			handleError(err.Error())
+		}
+		defer file.Close()
+		transcript = file
+	}
+
+	result, err := verifySchedule(network, startStation, endStation, numTrains, transcript)
+	if err != nil {
+		handleError(err.Error())
+	}
+	for _, v := range result.Violations {
+		if v.Turn == 0 {
+			fmt.Println("Schedule:", v.Message)
+		} else {
+			fmt.Printf("Turn %d: %s\n", v.Turn, v.Message)
+		}
+	}
+	fmt.Printf("Turns: %d\n", result.Turns)
+	if len(result.Violations) > 0 {
+		fmt.Printf("%d violations\n", len(result.Violations))
+		os.Exit(1)
+	}
+	fmt.Println("Schedule is valid")
+}